@@ -0,0 +1,78 @@
+package virtualbox
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+type ACPIStatus struct {
+	Enabled             bool // ACPI is enabled in the machine configuration
+	AdditionsRunLevel   int  // 0 without running Guest Additions, up to 3 for a desktop
+	GuestHandlesButtons bool // the guest is expected to act on ACPI button events
+}
+
+// Press the virtual ACPI power button, asking the guest to shut down.
+func (machine *Machine) ACPIPowerButton() error {
+	return machine.controlVM("acpipowerbutton")
+}
+
+// Press the virtual ACPI sleep button, asking the guest to suspend.
+func (machine *Machine) ACPISleepButton() error {
+	return machine.controlVM("acpisleepbutton")
+}
+
+// Determine whether the guest will handle ACPI button events. VirtualBox
+// does not report this directly, so the guest counts as handling them when
+// ACPI is enabled and the Guest Additions report the OS is up.
+func (machine *Machine) ACPIStatus() (*ACPIStatus, error) {
+	info, err := showVMInfo(machine.UUID.String())
+	if err != nil {
+		return nil, err
+	}
+	status := &ACPIStatus{Enabled: info["acpi"] == "on"}
+	if runLevel, err := strconv.Atoi(info["GuestAdditionsRunLevel"]); err == nil {
+		status.AdditionsRunLevel = runLevel
+	}
+	status.GuestHandlesButtons = status.Enabled && status.AdditionsRunLevel > 0
+	return status, nil
+}
+
+// Stop the machine with the ACPI power button if the guest handles it, and
+// with a hard power off otherwise. An ACPI stop returns once the button is
+// pressed, while the guest may still be shutting down.
+func (machine *Machine) Stop() error {
+	status, err := machine.ACPIStatus()
+	if err != nil {
+		return err
+	}
+	if status.GuestHandlesButtons {
+		return machine.ACPIPowerButton()
+	}
+	return machine.PowerOff()
+}
+
+// How often state changes are polled for.
+var PollInterval = time.Second
+
+// Wait until the machine reaches the given state or the context is done. A
+// machine that crashed while stopping counts as Off.
+func (machine *Machine) waitStatus(ctx context.Context, want Status) error {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := machine.queryStatus()
+		if err != nil {
+			return err
+		}
+		if status == want || want == Off && status == Aborted {
+			machine.Status = status
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
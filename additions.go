@@ -0,0 +1,103 @@
+package virtualbox
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AdditionsFacilityStatus string
+
+const (
+	FacilityInactive    = AdditionsFacilityStatus("Inactive")
+	FacilityPaused      = AdditionsFacilityStatus("Paused")
+	FacilityPreInit     = AdditionsFacilityStatus("PreInit")
+	FacilityInit        = AdditionsFacilityStatus("Init")
+	FacilityActive      = AdditionsFacilityStatus("Active")
+	FacilityTerminating = AdditionsFacilityStatus("Terminating")
+	FacilityTerminated  = AdditionsFacilityStatus("Terminated")
+	FacilityFailed      = AdditionsFacilityStatus("Failed")
+	FacilityUnknown     = AdditionsFacilityStatus("Unknown")
+)
+
+// Names of the facilities the Guest Additions report.
+const (
+	FacilityBaseDriver         = "VirtualBox Base Driver"
+	FacilityVBoxService        = "VirtualBox System Service"
+	FacilityDesktopIntegration = "VirtualBox Desktop Integration"
+	FacilityGraphics           = "Graphics Mode"
+	FacilitySeamless           = "Seamless Mode"
+)
+
+// The numbers showvminfo reports the facility states as.
+var additionsFacilityStatuses = map[int]AdditionsFacilityStatus{
+	0:   FacilityInactive,
+	1:   FacilityPaused,
+	20:  FacilityPreInit,
+	30:  FacilityInit,
+	50:  FacilityActive,
+	100: FacilityTerminating,
+	101: FacilityTerminated,
+	800: FacilityFailed,
+	999: FacilityUnknown,
+}
+
+// A part of the Guest Additions, such as the service running guest control.
+type AdditionsFacility struct {
+	Name    string
+	Status  AdditionsFacilityStatus
+	Changed time.Time `json:",omitempty"`
+}
+
+const additionsFacilityPrefix = "GuestAdditionsFacility_"
+
+// Parse the GuestAdditionsFacility_<name>=<status>,<milliseconds> values.
+func parseAdditionsFacilities(info map[string]string) []AdditionsFacility {
+	var facilities []AdditionsFacility
+	for key, value := range info {
+		name, found := strings.CutPrefix(key, additionsFacilityPrefix)
+		if !found {
+			continue
+		}
+		facility := AdditionsFacility{Name: name, Status: FacilityUnknown}
+		status, changed, _ := strings.Cut(value, ",")
+		if number, err := strconv.Atoi(status); err == nil && additionsFacilityStatuses[number] != "" {
+			facility.Status = additionsFacilityStatuses[number]
+		}
+		if milliseconds, err := strconv.ParseInt(changed, 10, 64); err == nil && milliseconds > 0 {
+			facility.Changed = time.UnixMilli(milliseconds).UTC()
+		}
+		facilities = append(facilities, facility)
+	}
+	sort.Slice(facilities, func(i, j int) bool {
+		return facilities[i].Name < facilities[j].Name
+	})
+	return facilities
+}
+
+// Get the state of the Guest Additions facilities of the running machine,
+// ordered by name. The run level only tells that the guest booted, while an
+// active FacilityVBoxService means guest control and properties work, and
+// an active FacilityGraphics that the desktop can be resized.
+func (machine *Machine) AdditionsFacilities() ([]AdditionsFacility, error) {
+	info, err := showVMInfo(machine.UUID.String())
+	if err != nil {
+		return nil, err
+	}
+	return parseAdditionsFacilities(info), nil
+}
+
+// Check if the facility with the name is active.
+func (machine *Machine) AdditionsFacilityActive(name string) (bool, error) {
+	facilities, err := machine.AdditionsFacilities()
+	if err != nil {
+		return false, err
+	}
+	for _, facility := range facilities {
+		if facility.Name == name {
+			return facility.Status == FacilityActive, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,123 @@
+package virtualbox
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type xmlGuestProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+var (
+	guestIPProperty     = regexp.MustCompile(`^/VirtualBox/GuestInfo/Net/(\d+)/V4/IP$`)
+	ansibleGroupInvalid = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// Get the IPv4 addresses of the guest interfaces, in interface order, from
+// the guest properties the Guest Additions set while the machine ran.
+func guestIPs(properties []xmlGuestProperty) []string {
+	byInterface := make(map[int]string)
+	var interfaces []int
+	for _, property := range properties {
+		match := guestIPProperty.FindStringSubmatch(property.Name)
+		if match == nil || net.ParseIP(property.Value) == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+		byInterface[index] = property.Value
+		interfaces = append(interfaces, index)
+	}
+	sort.Ints(interfaces)
+	var ips []string
+	for _, index := range interfaces {
+		ips = append(ips, byInterface[index])
+	}
+	return ips
+}
+
+type ansibleGroup struct {
+	Hosts []string `json:"hosts"`
+}
+
+type ansibleInventory struct {
+	groups   map[string]*ansibleGroup
+	hostvars map[string]map[string]interface{}
+}
+
+func (inventory *ansibleInventory) add(group, host string) {
+	group = strings.Trim(ansibleGroupInvalid.ReplaceAllString(group, "_"), "_")
+	if inventory.groups[group] == nil {
+		inventory.groups[group] = &ansibleGroup{}
+	}
+	inventory.groups[group].Hosts = append(inventory.groups[group].Hosts, host)
+}
+
+func (inventory *ansibleInventory) MarshalJSON() ([]byte, error) {
+	output := make(map[string]interface{}, len(inventory.groups)+1)
+	for name, group := range inventory.groups {
+		sort.Strings(group.Hosts)
+		output[name] = group
+	}
+	output["_meta"] = map[string]interface{}{"hostvars": inventory.hostvars}
+	return json.Marshal(output)
+}
+
+// Get the variables Ansible connects to the machine with. Machines
+// forwarding a host port to SSH in the guest are reached through it, the
+// others on the first address reported by the Guest Additions.
+func (machine *Machine) ansibleHostVars() map[string]interface{} {
+	vars := map[string]interface{}{
+		"virtualbox_uuid":   machine.UUID.String(),
+		"virtualbox_status": string(machine.Status),
+		"virtualbox_ostype": string(machine.OSType),
+	}
+	if len(machine.guestIPs) != 0 {
+		vars["virtualbox_guest_ips"] = machine.guestIPs
+		vars["ansible_host"] = machine.guestIPs[0]
+	}
+	for _, forward := range machine.Forwards {
+		if forward.GuestPort == 22 && forward.Protocol != UDP {
+			host, _, _ := net.SplitHostPort(forward.HostAddress())
+			vars["ansible_host"] = host
+			vars["ansible_port"] = int(forward.HostPort)
+			break
+		}
+	}
+	return vars
+}
+
+// Write the machines as an Ansible dynamic inventory, for an inventory
+// script to print on --list. Machines are hosts named after the machine,
+// in the groups status_<status>, group_<group> for every machine group
+// and tag_<tag> for every tag, with characters Ansible rejects in group
+// names replaced by underscores.
+func (vbox *VirtualBox) WriteAnsibleInventory(w io.Writer) error {
+	inventory := &ansibleInventory{
+		groups:   make(map[string]*ansibleGroup),
+		hostvars: make(map[string]map[string]interface{}),
+	}
+	vbox.mutex.RLock()
+	for _, machine := range vbox.Machines {
+		inventory.hostvars[machine.Name] = machine.ansibleHostVars()
+		if machine.Status != "" {
+			inventory.add("status_"+strings.ToLower(string(machine.Status)), machine.Name)
+		}
+		for _, group := range machine.Groups {
+			if group != "/" {
+				inventory.add("group"+group, machine.Name)
+			}
+		}
+		for _, tag := range machine.Tags {
+			inventory.add("tag_"+tag, machine.Name)
+		}
+	}
+	vbox.mutex.RUnlock()
+	return json.NewEncoder(w).Encode(inventory)
+}
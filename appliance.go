@@ -0,0 +1,319 @@
+package virtualbox
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timestamp written in place of the real ones by ExportReproducible.
+var ReproducibleTime = time.Unix(0, 0).UTC()
+
+var (
+	manifestLine = regexp.MustCompile(`^(SHA1|SHA256|SHA512) ?\((.+)\) ?= ?([0-9a-fA-F]+)$`)
+
+	// timestamps VirtualBox embeds in the machine section of the OVF
+	ovfTimestamp = regexp.MustCompile(
+		`\b(lastStateChange|timeStamp|lastModified)="[^"]*"`)
+)
+
+// Mismatch between a file and its manifest digest.
+type ManifestError struct {
+	File     string
+	Expected string
+	Actual   string
+}
+
+func (e *ManifestError) Error() string {
+	if e.Actual == "" {
+		return fmt.Sprintf("virtualbox: %s listed in manifest is missing", e.File)
+	}
+	return fmt.Sprintf("virtualbox: %s digest %s does not match manifest %s",
+		e.File, e.Actual, e.Expected)
+}
+
+func newManifestHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New()
+	case "SHA512":
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+type manifestEntry struct {
+	algorithm string
+	digest    string
+}
+
+func parseApplianceManifest(r io.Reader) (map[string]manifestEntry, error) {
+	entries := make(map[string]manifestEntry)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		match := manifestLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("virtualbox: invalid manifest line %q", line)
+		}
+		entries[match[2]] = manifestEntry{match[1], strings.ToLower(match[3])}
+	}
+	return entries, scanner.Err()
+}
+
+func digestFile(filePath, algorithm string) (string, error) {
+	release, err := acquireMediumSlot(context.Background())
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := newManifestHash(algorithm)
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify the files of an appliance against its manifest. For an OVF the
+// manifest is the .mf file next to it, for an OVA it is the .mf member of
+// the archive. Appliances without a manifest fail verification.
+func VerifyManifest(appliance string) error {
+	if strings.EqualFold(filepath.Ext(appliance), ".ova") {
+		return verifyOVAManifest(appliance)
+	}
+	manifestPath := strings.TrimSuffix(appliance, filepath.Ext(appliance)) + ".mf"
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return err
+	}
+	entries, err := parseApplianceManifest(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(appliance)
+	for name, entry := range entries {
+		digest, err := digestFile(filepath.Join(dir, name), entry.algorithm)
+		if os.IsNotExist(err) {
+			return &ManifestError{File: name, Expected: entry.digest}
+		}
+		if err != nil {
+			return err
+		}
+		if digest != entry.digest {
+			return &ManifestError{File: name, Expected: entry.digest, Actual: digest}
+		}
+	}
+	return nil
+}
+
+func verifyOVAManifest(appliance string) error {
+	release, err := acquireMediumSlot(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	file, err := os.Open(appliance)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	digests := make(map[string]map[string]string) // algorithm, file, digest
+	var entries map[string]manifestEntry
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(path.Ext(header.Name), ".mf") {
+			entries, err = parseApplianceManifest(reader)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// the manifest precedes the files, but hash with every algorithm
+		// when it has not been seen yet
+		hashes := map[string]hash.Hash{}
+		writers := []io.Writer{}
+		for _, algorithm := range []string{"SHA1", "SHA256", "SHA512"} {
+			hashes[algorithm] = newManifestHash(algorithm)
+			writers = append(writers, hashes[algorithm])
+		}
+		_, err = io.Copy(io.MultiWriter(writers...), reader)
+		if err != nil {
+			return err
+		}
+		for algorithm, h := range hashes {
+			if digests[algorithm] == nil {
+				digests[algorithm] = make(map[string]string)
+			}
+			digests[algorithm][header.Name] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	if entries == nil {
+		return fmt.Errorf("virtualbox: %s has no manifest", appliance)
+	}
+	for name, entry := range entries {
+		digest, ok := digests[entry.algorithm][name]
+		if !ok {
+			return &ManifestError{File: name, Expected: entry.digest}
+		}
+		if digest != entry.digest {
+			return &ManifestError{File: name, Expected: entry.digest, Actual: digest}
+		}
+	}
+	return nil
+}
+
+// Replace the timestamps VirtualBox writes into the OVF.
+func normalizeOVF(ovfPath string) error {
+	data, err := os.ReadFile(ovfPath)
+	if err != nil {
+		return err
+	}
+	stamp := ReproducibleTime.Format("2006-01-02T15:04:05Z")
+	data = ovfTimestamp.ReplaceAll(data, []byte(`$1="`+stamp+`"`))
+	return os.WriteFile(ovfPath, data, 0644)
+}
+
+// Export the machine as an OVF, or an OVA if the output ends in .ova, such
+// that exporting the same machine yields the same bytes as far as
+// VirtualBox allows: timestamps in the OVF are normalized, files are stored
+// in a stable order with fixed metadata, and a SHA-256 manifest is written
+// so the artifact can be content addressed and checked with VerifyManifest.
+func (machine *Machine) ExportReproducible(ctx context.Context, output string) error {
+	if ReadOnly {
+		return ErrReadOnly
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(output), ".export")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	base := strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+	ovfName := base + ".ovf"
+	_, err = machine.manageMedium(ctx, "export", machine.UUID.String(),
+		"--output", filepath.Join(dir, ovfName))
+	if err != nil {
+		return err
+	}
+	err = normalizeOVF(filepath.Join(dir, ovfName))
+	if err != nil {
+		return err
+	}
+
+	// the OVF must come first, followed by the manifest, then the disks
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() != ovfName && !strings.EqualFold(filepath.Ext(entry.Name()), ".mf") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{ovfName}, names...)
+
+	var manifest strings.Builder
+	for _, name := range names {
+		digest, err := digestFile(filepath.Join(dir, name), "SHA256")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "SHA256(%s)= %s\n", name, digest)
+	}
+	manifestName := base + ".mf"
+	err = os.WriteFile(filepath.Join(dir, manifestName), []byte(manifest.String()), 0644)
+	if err != nil {
+		return err
+	}
+	names = append([]string{ovfName, manifestName}, names[1:]...)
+
+	if !strings.EqualFold(filepath.Ext(output), ".ova") {
+		for _, name := range names {
+			err = os.Rename(filepath.Join(dir, name), filepath.Join(filepath.Dir(output), name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeOVA(output, dir, names)
+}
+
+func writeOVA(output, dir string, names []string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	writer := tar.NewWriter(file)
+	for _, name := range names {
+		err = addTarFile(writer, filepath.Join(dir, name), name)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func addTarFile(writer *tar.Writer, filePath, name string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	err = writer.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: ReproducibleTime,
+		Format:  tar.FormatUSTAR,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
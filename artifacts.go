@@ -0,0 +1,142 @@
+package virtualbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The file CollectArtifacts writes the manifest to in the host directory.
+const ArtifactManifestFile = "manifest.json"
+
+// Limits applied by CollectArtifacts. Files larger than MaxArtifactSize are
+// skipped, as are files once MaxArtifactsSize bytes were collected. Zero
+// removes the respective limit.
+var (
+	MaxArtifactSize  int64 = 100 << 20
+	MaxArtifactsSize int64 = 1 << 30
+)
+
+// A file in the guest matched by CollectArtifacts.
+type Artifact struct {
+	GuestPath string
+	HostPath  string `json:",omitempty"` // relative to the host directory
+	Size      int64
+	SHA256    string `json:",omitempty"`
+	Skipped   string `json:",omitempty"` // why the file was not collected
+}
+
+type ArtifactManifest struct {
+	Machine   string
+	Collected time.Time
+	Artifacts []Artifact
+}
+
+// Expands the patterns given as arguments without splitting them on spaces
+// and prints the size and path of every regular file matched.
+const listArtifactsScript = `IFS=
+for pattern; do
+	for file in $pattern; do
+		[ -f "$file" ] && printf '%s\t%s\n' "$(wc -c < "$file")" "$file"
+	done
+done
+exit 0`
+
+// Copy the regular files in the guest matching the shell patterns, such as
+// /var/log/*.log, into the host directory below their guest path, and write
+// a manifest of what was collected and skipped to ArtifactManifestFile
+// there. Files that fail to copy are recorded as skipped instead of
+// stopping the collection. The guest needs a POSIX shell.
+func (machine *Machine) CollectArtifacts(ctx context.Context, creds GuestCredentials, guestGlobs []string, hostDir string) (*ArtifactManifest, error) {
+	bytes, err := machine.guestRun(ctx, creds, "/bin/sh",
+		append([]string{"-c", listArtifactsScript, "sh"}, guestGlobs...)...)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ArtifactManifest{Machine: machine.Name, Collected: time.Now().UTC()}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(bytes), "\n") {
+		size, guestPath, found := strings.Cut(line, "\t")
+		if !found || seen[guestPath] {
+			continue
+		}
+		seen[guestPath] = true
+		artifact := Artifact{GuestPath: guestPath}
+		artifact.Size, _ = strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		manifest.Artifacts = append(manifest.Artifacts, artifact)
+	}
+
+	var total int64
+	for index := range manifest.Artifacts {
+		artifact := &manifest.Artifacts[index]
+		if MaxArtifactSize != 0 && artifact.Size > MaxArtifactSize {
+			artifact.Skipped = fmt.Sprintf("larger than %d bytes", MaxArtifactSize)
+			continue
+		}
+		if MaxArtifactsSize != 0 && total+artifact.Size > MaxArtifactsSize {
+			artifact.Skipped = fmt.Sprintf("over the total of %d bytes", MaxArtifactsSize)
+			continue
+		}
+		err := machine.collectArtifact(ctx, creds, artifact, hostDir)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			artifact.HostPath = ""
+			artifact.Skipped = err.Error()
+			continue
+		}
+		total += artifact.Size
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(hostDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(hostDir, ArtifactManifestFile), append(data, '\n'), 0644)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Copy the artifact below the host directory, recording where it was
+// stored and the size and checksum of the copy.
+func (machine *Machine) collectArtifact(ctx context.Context, creds GuestCredentials, artifact *Artifact, hostDir string) error {
+	// cleaning the rooted path keeps the copy inside the host directory
+	artifact.HostPath = filepath.FromSlash(strings.TrimPrefix(path.Clean("/"+artifact.GuestPath), "/"))
+	hostPath := filepath.Join(hostDir, artifact.HostPath)
+	err := os.MkdirAll(filepath.Dir(hostPath), 0755)
+	if err != nil {
+		return err
+	}
+	err = machine.guestCopy(ctx, "copyfrom", creds, artifact.GuestPath, hostPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(hostPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	artifact.Size, err = io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	artifact.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
@@ -0,0 +1,249 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// A provisioning command run inside the guest while baking.
+type BakeStep struct {
+	Name string
+	Exe  string
+	Args []string `json:",omitempty"`
+}
+
+// Describes how to bake a golden image: start from an installer ISO or a
+// base OVA, run provisioning steps through guest control, shut down, compact
+// the disks, take a "clean" snapshot and optionally export an appliance.
+type Bake struct {
+	Name   string
+	OSType OSType // required for ISO installs
+	ISO    string // installed through "VBoxManage unattended install"
+	OVA    string // imported as the starting point instead of an ISO
+
+	DiskSizeMB int // size of the disk created for ISO installs, required for them
+	Memory     int `json:",omitempty"`
+	CPUs       int `json:",omitempty"`
+
+	// Account created by the unattended install, or existing in the OVA, and
+	// used to run the steps.
+	Credentials GuestCredentials
+	Steps       []BakeStep
+
+	VerifyManifest  bool          // check the OVA against its manifest first
+	ShutdownTimeout time.Duration // defaults to 5 minutes
+	Output          string        // exported with ExportReproducible, skipped if empty
+}
+
+// Name of the snapshot taken once the image is baked.
+const CleanSnapshot = "clean"
+
+// Interval between attempts to reach the guest while it boots.
+var BakeGuestPollInterval = 5 * time.Second
+
+// Bake the image and return the resulting machine, which is left registered
+// and powered off at the clean snapshot. Errors identify the failing stage.
+func (bake *Bake) Run(ctx context.Context) (*Machine, error) {
+	if (bake.ISO == "") == (bake.OVA == "") {
+		return nil, errors.New("virtualbox: bake needs exactly one of ISO or OVA")
+	}
+	if bake.ISO != "" && bake.DiskSizeMB <= 0 {
+		return nil, errors.New("virtualbox: bake needs a DiskSizeMB for ISO installs")
+	}
+	var machine *Machine
+	var err error
+	if bake.ISO != "" {
+		machine, err = bake.install(ctx)
+	} else {
+		machine, err = bake.importOVA(ctx)
+	}
+	if err != nil {
+		return machine, err
+	}
+
+	err = bake.waitForGuest(ctx, machine)
+	if err != nil {
+		return machine, fmt.Errorf("virtualbox: bake waiting for guest: %w", err)
+	}
+	for _, step := range bake.Steps {
+		_, err = machine.guestRun(ctx, bake.Credentials, step.Exe, step.Args...)
+		if err != nil {
+			return machine, fmt.Errorf("virtualbox: bake step %s: %w", step.Name, err)
+		}
+	}
+
+	err = bake.shutdown(ctx, machine)
+	if err != nil {
+		return machine, fmt.Errorf("virtualbox: bake shutdown: %w", err)
+	}
+	err = bake.compact(ctx, machine)
+	if err != nil {
+		return machine, fmt.Errorf("virtualbox: bake compact: %w", err)
+	}
+	_, err = machine.manage(ctx, "snapshot", machine.UUID.String(),
+		"take", CleanSnapshot, "--description", "Baked image")
+	if err != nil {
+		return machine, fmt.Errorf("virtualbox: bake snapshot: %w", err)
+	}
+	if bake.Output != "" {
+		err = machine.ExportReproducible(ctx, bake.Output)
+		if err != nil {
+			return machine, fmt.Errorf("virtualbox: bake export: %w", err)
+		}
+	}
+	return machine, nil
+}
+
+func (bake *Bake) hardware() (args []string) {
+	if bake.Memory != 0 {
+		args = append(args, "--memory", strconv.Itoa(bake.Memory))
+	}
+	if bake.CPUs != 0 {
+		args = append(args, "--cpus", strconv.Itoa(bake.CPUs))
+	}
+	return
+}
+
+func (bake *Bake) install(ctx context.Context) (*Machine, error) {
+	machine, err := CreateMachine{
+		Name:     bake.Name,
+		OSType:   bake.OSType,
+		Register: true,
+	}.CreateContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := machine.UUID.String()
+	if hardware := bake.hardware(); len(hardware) != 0 {
+		err = machine.modifyVM(hardware...)
+		if err != nil {
+			return machine, err
+		}
+	}
+
+	disk := filepath.Join(machine.Folder(), bake.Name+".vdi")
+	_, err = vboxManageMediumContext(ctx, "createmedium", "disk",
+		"--filename", disk, "--size", strconv.Itoa(bake.DiskSizeMB))
+	if err != nil {
+		return machine, err
+	}
+	_, err = machine.manage(ctx, "storagectl", id,
+		"--name", "SATA", "--add", "sata")
+	if err != nil {
+		return machine, err
+	}
+	_, err = machine.manage(ctx, "storageattach", id,
+		"--storagectl", "SATA", "--port", "0", "--device", "0",
+		"--type", "hdd", "--medium", disk)
+	if err != nil {
+		return machine, err
+	}
+
+	_, err = machine.manage(ctx, "unattended", "install", id,
+		"--iso="+bake.ISO,
+		"--user="+bake.Credentials.Username,
+		"--password="+bake.Credentials.Password,
+		"--install-additions",
+		"--start-vm=headless")
+	if err != nil {
+		return machine, fmt.Errorf("virtualbox: bake install: %w", err)
+	}
+	machine.Status = Running
+	return machine, nil
+}
+
+func (bake *Bake) importOVA(ctx context.Context) (*Machine, error) {
+	if bake.VerifyManifest {
+		err := VerifyManifest(bake.OVA)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := vboxManageMediumContext(ctx, "import", bake.OVA,
+		"--vsys", "0", "--vmname", bake.Name)
+	if err != nil {
+		return nil, fmt.Errorf("virtualbox: bake import: %w", err)
+	}
+	machine, _, err := showMachine(ctx, bake.Name)
+	if err != nil {
+		return nil, err
+	}
+	if hardware := bake.hardware(); len(hardware) != 0 {
+		err = machine.modifyVM(hardware...)
+		if err != nil {
+			return machine, err
+		}
+	}
+	return machine, machine.StartContext(ctx, true)
+}
+
+// Wait until guest control can run a command, which means the guest has
+// booted and the Guest Additions are up.
+func (bake *Bake) waitForGuest(ctx context.Context, machine *Machine) error {
+	exe := "/bin/true"
+	if strings.HasPrefix(string(bake.OSType), "Windows") {
+		exe = `C:\Windows\System32\hostname.exe`
+	}
+	for {
+		_, err := machine.guestRun(ctx, bake.Credentials, exe)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(BakeGuestPollInterval):
+		}
+	}
+}
+
+// Shut the guest down cleanly, powering off if it does not halt in time.
+func (bake *Bake) shutdown(ctx context.Context, machine *Machine) error {
+	timeout := bake.ShutdownTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	_, err := machine.Shutdown(ctx, ShutdownOptions{Steps: []ShutdownStep{
+		{ShutdownACPI, timeout},
+		{ShutdownPowerOff, 0},
+	}})
+	return err
+}
+
+// Compact every disk image attached to the machine, skipping the DVDs such
+// as the installer ISO.
+func (bake *Bake) compact(ctx context.Context, machine *Machine) error {
+	bytes, err := vboxManageContext(ctx, "list", "hdds")
+	if err != nil {
+		return err
+	}
+	disks, err := parseListedHardDisks(string(bytes))
+	if err != nil {
+		return err
+	}
+	_, info, err := showMachine(ctx, machine.UUID.String())
+	if err != nil {
+		return err
+	}
+	for key, value := range info {
+		if !strings.Contains(key, "-ImageUUID-") {
+			continue
+		}
+		diskUUID, err := uuid.ParseHex(value)
+		if err != nil || disks[*diskUUID] == nil {
+			continue
+		}
+		_, err = vboxManageMediumContext(ctx, "modifymedium", "disk", value, "--compact")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package virtualbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The number of samples a BandwidthMonitor keeps when Capacity is zero.
+const DefaultBandwidthCapacity = 8640
+
+// The network traffic of a machine over one period.
+type BandwidthSample struct {
+	Time    time.Time
+	Machine string
+	Period  time.Duration
+	RxRate  float64 // bytes per second received by the guest
+	TxRate  float64 // bytes per second sent by the guest
+}
+
+// The traffic of a machine, or of an environment, summed over samples.
+type BandwidthUsage struct {
+	Machine    string `json:",omitempty"`
+	RxBytes    float64
+	TxBytes    float64
+	PeakRxRate float64
+	PeakTxRate float64
+}
+
+// Records the network traffic of the running machines from the Net/Rate
+// metrics of VirtualBox into a ring buffer, to find the machines using
+// most of the bandwidth of a shared host.
+type BandwidthMonitor struct {
+	Interval time.Duration // 10 seconds if zero
+	Capacity int           // DefaultBandwidthCapacity if zero
+
+	OnError func(err error) // optional
+
+	mutex   sync.Mutex
+	samples []BandwidthSample
+	next    int // where the next sample goes once the buffer is full
+}
+
+var bandwidthUnits = map[string]float64{
+	"B/s":  1,
+	"kB/s": 1 << 10,
+	"MB/s": 1 << 20,
+	"GB/s": 1 << 30,
+}
+
+func (monitor *BandwidthMonitor) interval() time.Duration {
+	if monitor.Interval == 0 {
+		return 10 * time.Second
+	}
+	return monitor.Interval
+}
+
+func (monitor *BandwidthMonitor) record(samples ...BandwidthSample) {
+	capacity := monitor.Capacity
+	if capacity <= 0 {
+		capacity = DefaultBandwidthCapacity
+	}
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	for _, sample := range samples {
+		if len(monitor.samples) < capacity {
+			monitor.samples = append(monitor.samples, sample)
+			continue
+		}
+		monitor.samples[monitor.next] = sample
+		monitor.next = (monitor.next + 1) % len(monitor.samples)
+	}
+}
+
+// Sample the traffic every Interval until the context is done. Failed
+// samples are reported to OnError.
+func (monitor *BandwidthMonitor) Run(ctx context.Context) error {
+	collector := &metricsCollector{
+		metrics: []string{"Net/Rate/Rx", "Net/Rate/Tx"},
+		period:  monitor.interval(),
+	}
+	ticker := time.NewTicker(monitor.interval())
+	defer ticker.Stop()
+	for {
+		values, err := collector.query(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && monitor.OnError != nil {
+			monitor.OnError(err)
+		}
+		now := time.Now()
+		byMachine := make(map[string]*BandwidthSample)
+		var machines []string
+		for _, value := range values {
+			scale, known := bandwidthUnits[value.Unit]
+			if value.Object == "host" || !known {
+				continue
+			}
+			sample := byMachine[value.Object]
+			if sample == nil {
+				sample = &BandwidthSample{Time: now, Machine: value.Object, Period: monitor.interval()}
+				byMachine[value.Object] = sample
+				machines = append(machines, value.Object)
+			}
+			rate := value.Values[len(value.Values)-1] * scale
+			switch value.Metric {
+			case "Net/Rate/Rx":
+				sample.RxRate = rate
+			case "Net/Rate/Tx":
+				sample.TxRate = rate
+			}
+		}
+		sort.Strings(machines)
+		for _, name := range machines {
+			monitor.record(*byMachine[name])
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Get the samples taken since the time, oldest first.
+func (monitor *BandwidthMonitor) Samples(since time.Time) []BandwidthSample {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	var samples []BandwidthSample
+	ordered := append(monitor.samples[monitor.next:len(monitor.samples):len(monitor.samples)],
+		monitor.samples[:monitor.next]...)
+	for _, sample := range ordered {
+		if !sample.Time.Before(since) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+func (usage *BandwidthUsage) add(sample BandwidthSample) {
+	usage.RxBytes += sample.RxRate * sample.Period.Seconds()
+	usage.TxBytes += sample.TxRate * sample.Period.Seconds()
+	if sample.RxRate > usage.PeakRxRate {
+		usage.PeakRxRate = sample.RxRate
+	}
+	if sample.TxRate > usage.PeakTxRate {
+		usage.PeakTxRate = sample.TxRate
+	}
+}
+
+// Get the traffic of every machine since the time, heaviest first.
+func (monitor *BandwidthMonitor) Usage(since time.Time) []BandwidthUsage {
+	byMachine := make(map[string]*BandwidthUsage)
+	for _, sample := range monitor.Samples(since) {
+		usage := byMachine[sample.Machine]
+		if usage == nil {
+			usage = &BandwidthUsage{Machine: sample.Machine}
+			byMachine[sample.Machine] = usage
+		}
+		usage.add(sample)
+	}
+	usages := make([]BandwidthUsage, 0, len(byMachine))
+	for _, usage := range byMachine {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		total := func(usage BandwidthUsage) float64 { return usage.RxBytes + usage.TxBytes }
+		if total(usages[i]) != total(usages[j]) {
+			return total(usages[i]) > total(usages[j])
+		}
+		return usages[i].Machine < usages[j].Machine
+	})
+	return usages
+}
+
+// Get the traffic of all the machines of the environment instance since
+// the time. The peaks are those of a single machine.
+func (monitor *BandwidthMonitor) EnvironmentUsage(env *Environment, since time.Time) BandwidthUsage {
+	names := make(map[string]bool, len(env.Manifest.Machines))
+	for _, machine := range env.Manifest.Machines {
+		names[env.MachineName(machine.Name)] = true
+	}
+	var usage BandwidthUsage
+	for _, sample := range monitor.Samples(since) {
+		if names[sample.Machine] {
+			usage.add(sample)
+		}
+	}
+	return usage
+}
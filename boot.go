@@ -0,0 +1,76 @@
+package virtualbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Guest Additions run levels reported through showvminfo.
+const (
+	AdditionsRunLevelNone     = 0
+	AdditionsRunLevelSystem   = 1 // the Guest Additions driver is loaded
+	AdditionsRunLevelUserland = 2 // VBoxService is running
+	AdditionsRunLevelDesktop  = 3 // a user is logged in to a desktop
+)
+
+// The state of a booting machine reported by Boot.
+type BootProgress struct {
+	Status            Status
+	AdditionsRunLevel int
+	Elapsed           time.Duration
+}
+
+// Start the machine and follow its boot until the Guest Additions reach the
+// given run level, calling report whenever the progress changes. Guests
+// without the Guest Additions never get past AdditionsRunLevelNone, so the
+// context should carry a deadline. This is the building block for starting
+// machines on demand from a dashboard, which needs to show more than whether
+// startvm returned.
+func (machine *Machine) Boot(ctx context.Context, frontend Frontend, runLevel int, report func(BootProgress)) error {
+	started := time.Now()
+	err := machine.StartFrontendContext(ctx, frontend)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	last := BootProgress{AdditionsRunLevel: -1}
+	for {
+		info, err := showVMInfo(machine.UUID.String())
+		if err != nil {
+			return err
+		}
+		progress := BootProgress{
+			Status:  parseVMState(info["VMState"]),
+			Elapsed: time.Since(started),
+		}
+		progress.AdditionsRunLevel, _ = strconv.Atoi(info["GuestAdditionsRunLevel"])
+		machine.Status = progress.Status
+
+		if report != nil && (progress.Status != last.Status ||
+			progress.AdditionsRunLevel != last.AdditionsRunLevel) {
+			report(progress)
+		}
+		last = progress
+
+		switch progress.Status {
+		case Running:
+			if progress.AdditionsRunLevel >= runLevel {
+				return nil
+			}
+		case Starting, Paused:
+		default:
+			return fmt.Errorf("virtualbox: machine %s is %s while booting",
+				machine.Name, progress.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
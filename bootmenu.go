@@ -0,0 +1,269 @@
+package virtualbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// When the firmware offers the F12 boot menu.
+type BootMenuMode string
+
+const (
+	BootMenuDisabled       = BootMenuMode("disabled")
+	BootMenuOnly           = BootMenuMode("menuonly") // without the prompt to press F12
+	BootMenuMessageAndMenu = BootMenuMode("messageandmenu")
+)
+
+type BootDevice string
+
+const (
+	BootNone    = BootDevice("none")
+	BootFloppy  = BootDevice("floppy")
+	BootDVD     = BootDevice("dvd")
+	BootDisk    = BootDevice("disk")
+	BootNetwork = BootDevice("net")
+)
+
+// The number of positions in the boot order, as in --boot1 to --boot4.
+const MaxBootDevices = 4
+
+// Used by VirtualBox when the settings do not specify a boot order.
+var defaultBootOrder = []BootDevice{BootFloppy, BootDVD, BootDisk}
+
+// The splash screen shown by the firmware while booting.
+type BootLogo struct {
+	FadeIn      bool
+	FadeOut     bool
+	DisplayTime time.Duration `json:",omitempty"`
+	ImagePath   string        `json:",omitempty"` // 640x480 BMP replacing the VirtualBox logo
+}
+
+// A Boot#### load option in the EFI NVRAM store.
+type EFIBootEntry struct {
+	Name        string // of the variable, such as Boot0001
+	Description string
+	Active      bool
+}
+
+var efiBootVariable = regexp.MustCompile(`^Boot[[:xdigit:]]{4}$`)
+
+type xmlLogo struct {
+	FadeIn      string `xml:"fadeIn,attr"`
+	FadeOut     string `xml:"fadeOut,attr"`
+	DisplayTime int64  `xml:"displayTime,attr"` // milliseconds
+	ImagePath   string `xml:"imagePath,attr"`
+}
+
+type xmlBootMenu struct {
+	Mode string `xml:"mode,attr"`
+}
+
+type xmlBootOrder struct {
+	Position int    `xml:"position,attr"`
+	Device   string `xml:"device,attr"`
+}
+
+// The device attribute of the boot order in the machine XML.
+var xmlBootDevices = map[string]BootDevice{
+	"None":     BootNone,
+	"Floppy":   BootFloppy,
+	"DVD":      BootDVD,
+	"HardDisk": BootDisk,
+	"Network":  BootNetwork,
+}
+
+// Apply the boot settings, kept in BIOS before VirtualBox 7.1 and in
+// Firmware after. Fading defaults to on, so only "false" turns it off.
+func (hardware *xmlHardware) applyBoot(machine *Machine) {
+	logo, menu := hardware.BIOSLogo, hardware.BIOSBootMenu
+	if logo == (xmlLogo{}) {
+		logo = hardware.Firmware.Logo
+	}
+	if menu.Mode == "" {
+		menu = hardware.Firmware.BootMenu
+	}
+	machine.BootLogo = &BootLogo{
+		FadeIn:      logo.FadeIn != "false",
+		FadeOut:     logo.FadeOut != "false",
+		DisplayTime: time.Duration(logo.DisplayTime) * time.Millisecond,
+		ImagePath:   logo.ImagePath,
+	}
+	machine.BootMenu = BootMenuMessageAndMenu
+	if menu.Mode != "" {
+		machine.BootMenu = BootMenuMode(strings.ToLower(menu.Mode))
+	}
+
+	order := make([]BootDevice, MaxBootDevices)
+	for _, entry := range hardware.BootOrder {
+		if entry.Position >= 1 && entry.Position <= MaxBootDevices {
+			order[entry.Position-1] = xmlBootDevices[entry.Device]
+		}
+	}
+	machine.BootOrder = nil
+	for _, device := range order {
+		if device != "" && device != BootNone {
+			machine.BootOrder = append(machine.BootOrder, device)
+		}
+	}
+	if len(hardware.BootOrder) == 0 {
+		machine.BootOrder = append([]BootDevice(nil), defaultBootOrder...)
+	}
+}
+
+// Set when the firmware offers the boot menu. Kiosk machines can disable it
+// to keep users from booting other media.
+func (machine *Machine) SetBootMenu(mode BootMenuMode) error {
+	err := machine.modifyVM("--biosbootmenu", string(mode))
+	if err != nil {
+		return err
+	}
+	machine.BootMenu = mode
+	return nil
+}
+
+// Set the splash screen shown by the firmware while booting, with the
+// --bioslogo options of modifyvm.
+func (machine *Machine) SetBootLogo(logo BootLogo) error {
+	err := machine.modifyVM(
+		"--bioslogofadein", onOff(logo.FadeIn),
+		"--bioslogofadeout", onOff(logo.FadeOut),
+		"--bioslogodisplaytime", strconv.FormatInt(int64(logo.DisplayTime/time.Millisecond), 10),
+		"--bioslogoimagepath", logo.ImagePath)
+	if err != nil {
+		return err
+	}
+	machine.BootLogo = &logo
+	return nil
+}
+
+// Set the devices to boot from, in order. The remaining positions are
+// cleared. The EFI firmware only uses the order for devices missing boot
+// entries in its NVRAM.
+func (machine *Machine) SetBootOrder(devices ...BootDevice) error {
+	args, err := bootOrderArgs(devices)
+	if err != nil {
+		return err
+	}
+	err = machine.modifyVM(args...)
+	if err != nil {
+		return err
+	}
+	machine.setBootOrder(devices)
+	return nil
+}
+
+// Get the --boot options setting every position.
+func bootOrderArgs(devices []BootDevice) ([]string, error) {
+	if len(devices) > MaxBootDevices {
+		return nil, errors.New("virtualbox: at most 4 boot devices are supported")
+	}
+	var args []string
+	for position := 0; position < MaxBootDevices; position++ {
+		device := BootNone
+		if position < len(devices) {
+			device = devices[position]
+		}
+		args = append(args, "--boot"+strconv.Itoa(position+1), string(device))
+	}
+	return args, nil
+}
+
+func (machine *Machine) setBootOrder(devices []BootDevice) {
+	machine.BootOrder = nil
+	for _, device := range devices {
+		if device != BootNone {
+			machine.BootOrder = append(machine.BootOrder, device)
+		}
+	}
+}
+
+// Read an EFI variable from the NVRAM store of the machine. VBoxManage can
+// only write the raw data to a file.
+func (machine *Machine) queryEFIVariable(name string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "nvram")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, name)
+	_, err = vboxManage("modifynvram", machine.UUID.String(),
+		"queryvar", "--name", name, "--filename", file)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(file)
+}
+
+// Get the boot entries stored in the EFI NVRAM, in the order given by the
+// BootOrder variable followed by any entries missing from it. The NVRAM is
+// created on the first start of the machine.
+func (machine *Machine) EFIBootEntries() ([]EFIBootEntry, error) {
+	bytes, err := vboxManage("modifynvram", machine.UUID.String(), "listvars")
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*EFIBootEntry)
+	var names []string
+	for _, line := range strings.Split(string(bytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !efiBootVariable.MatchString(fields[0]) {
+			continue
+		}
+		data, err := machine.queryEFIVariable(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		entry, err := parseEFILoadOption(fields[0], data)
+		if err != nil {
+			return nil, err
+		}
+		entries[entry.Name] = entry
+		names = append(names, entry.Name)
+	}
+
+	var ordered []EFIBootEntry
+	if order, err := machine.queryEFIVariable("BootOrder"); err == nil {
+		for index := 0; index+1 < len(order); index += 2 {
+			name := fmt.Sprintf("Boot%04X", binary.LittleEndian.Uint16(order[index:]))
+			if entry := entries[name]; entry != nil {
+				ordered = append(ordered, *entry)
+				delete(entries, name)
+			}
+		}
+	}
+	for _, name := range names {
+		if entry := entries[name]; entry != nil {
+			ordered = append(ordered, *entry)
+		}
+	}
+	return ordered, nil
+}
+
+// Parse the attributes and description of an EFI_LOAD_OPTION.
+func parseEFILoadOption(name string, data []byte) (*EFIBootEntry, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("virtualbox: invalid EFI load option %s", name)
+	}
+	entry := &EFIBootEntry{
+		Name:   name,
+		Active: binary.LittleEndian.Uint32(data)&1 != 0,
+	}
+	var description []uint16
+	for index := 6; index+1 < len(data); index += 2 {
+		char := binary.LittleEndian.Uint16(data[index:])
+		if char == 0 {
+			break
+		}
+		description = append(description, char)
+	}
+	entry.Description = string(utf16.Decode(description))
+	return entry, nil
+}
@@ -0,0 +1,100 @@
+package virtualbox
+
+import (
+	"strings"
+)
+
+type Chipset string
+
+const (
+	PIIX3 = Chipset("piix3")
+	ICH9  = Chipset("ich9")
+)
+
+type xmlEnabled struct {
+	Enabled bool `xml:"enabled,attr"`
+}
+
+type xmlChipset struct {
+	Type string `xml:"type,attr"`
+}
+
+type xmlRTC struct {
+	LocalOrUTC string `xml:"localOrUTC,attr"`
+}
+
+// The Platform element introduced in VirtualBox 7.1, which holds settings
+// previously found directly in Hardware.
+type xmlPlatform struct {
+	Architecture string         `xml:"architecture,attr"`
+	Chipset      xmlChipset     `xml:"Chipset"`
+	HPET         xmlEnabled     `xml:"x86>HPET"`
+	CPU          xmlCPUFeatures `xml:"x86>CPU"`
+	RTC          xmlRTC         `xml:"RTC"`
+}
+
+// Chipset and clock related settings in their locations in Hardware before
+// VirtualBox 7.1.
+type xmlPlatformSettings struct {
+	Chipset xmlChipset `xml:"Chipset"`
+	IOAPIC  xmlEnabled `xml:"BIOS>IOAPIC"`
+	HPET    xmlEnabled `xml:"HPET"`
+	RTC     xmlRTC     `xml:"RTC"`
+}
+
+func (settings *xmlPlatformSettings) apply(machine *Machine, platform *xmlPlatform, firmware *xmlFirmware) {
+	chipset := settings.Chipset.Type
+	if chipset == "" {
+		chipset = platform.Chipset.Type
+	}
+	machine.Chipset = PIIX3
+	if chipset != "" {
+		machine.Chipset = Chipset(strings.ToLower(chipset))
+	}
+	machine.IOAPIC = settings.IOAPIC.Enabled || firmware.IOAPIC.Enabled
+	machine.HPET = settings.HPET.Enabled || platform.HPET.Enabled
+	machine.RTCUseUTC = settings.RTC.LocalOrUTC == "UTC" ||
+		platform.RTC.LocalOrUTC == "UTC"
+}
+
+// Set the emulated chipset. ICH9 is required for more than 4 PCI network
+// adapters and PCIe devices.
+func (machine *Machine) SetChipset(chipset Chipset) error {
+	err := machine.modifyVM("--chipset", string(chipset))
+	if err != nil {
+		return err
+	}
+	machine.Chipset = chipset
+	return nil
+}
+
+// Enable or disable the I/O APIC, which guests with more than one CPU need.
+func (machine *Machine) SetIOAPIC(enabled bool) error {
+	err := machine.modifyVM("--ioapic", onOff(enabled))
+	if err != nil {
+		return err
+	}
+	machine.IOAPIC = enabled
+	return nil
+}
+
+// Enable or disable the High Precision Event Timer.
+func (machine *Machine) SetHPET(enabled bool) error {
+	err := machine.modifyVM("--hpet", onOff(enabled))
+	if err != nil {
+		return err
+	}
+	machine.HPET = enabled
+	return nil
+}
+
+// Set whether the real time clock is in UTC, as Linux guests expect, rather
+// than local time, as Windows guests expect.
+func (machine *Machine) SetRTCUseUTC(utc bool) error {
+	err := machine.modifyVM("--rtcuseutc", onOff(utc))
+	if err != nil {
+		return err
+	}
+	machine.RTCUseUTC = utc
+	return nil
+}
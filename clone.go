@@ -0,0 +1,122 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// What part of the snapshot tree clonevm copies.
+type CloneMode string
+
+const (
+	CloneMachineState       = CloneMode("machine") // the current state only
+	CloneMachineAndChildren = CloneMode("machineandchildren")
+	CloneAll                = CloneMode("all") // every snapshot
+)
+
+type CloneMachine struct {
+	Name       string
+	Mode       CloneMode  // defaults to CloneMachineState
+	Snapshot   *uuid.UUID // clone this snapshot instead of the current state
+	Linked     bool       // use differencing disks on the snapshot instead of copies
+	KeepMACs   bool       // keep the MAC addresses of all network adapters
+	BaseFolder string
+	Groups     []string
+	UUID       *uuid.UUID // generated if nil
+	Register   bool
+}
+
+// Clone the machine with clonevm and return the UUID of the clone. Linked
+// clones need a snapshot and use the current snapshot if none is given.
+func (machine *Machine) Clone(options CloneMachine) (*uuid.UUID, error) {
+	return machine.CloneContext(context.Background(), options)
+}
+
+// Clone the machine, killing VBoxManage if the context is done first.
+func (machine *Machine) CloneContext(ctx context.Context, options CloneMachine) (*uuid.UUID, error) {
+	err := ValidateMachineName(options.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !inNamespace(options.Name, options.Groups) {
+		return nil, ErrOutsideNamespace
+	}
+	cloneUUID := options.UUID
+	if cloneUUID == nil {
+		cloneUUID, err = uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+	}
+	snapshot := options.Snapshot
+	if snapshot == nil && options.Linked {
+		snapshot = machine.CurrentSnapshot
+		if snapshot == nil {
+			return nil, errors.New("virtualbox: linked clones need a snapshot")
+		}
+	}
+
+	args := []string{"clonevm", machine.UUID.String(),
+		"--name", options.Name, "--uuid", cloneUUID.String()}
+	if options.Mode != "" {
+		args = append(args, "--mode", string(options.Mode))
+	}
+	if snapshot != nil {
+		args = append(args, "--snapshot", snapshot.String())
+	}
+	var cloneOptions []string
+	if options.Linked {
+		cloneOptions = append(cloneOptions, "link")
+	}
+	if options.KeepMACs {
+		cloneOptions = append(cloneOptions, "keepallmacs")
+	}
+	if len(cloneOptions) != 0 {
+		args = append(args, "--options", strings.Join(cloneOptions, ","))
+	}
+	if options.BaseFolder != "" {
+		args = append(args, "--basefolder", options.BaseFolder)
+	}
+	if len(options.Groups) != 0 {
+		args = append(args, "--groups", strings.Join(options.Groups, ","))
+	}
+	if options.Register {
+		args = append(args, "--register")
+	}
+	_, err = machine.manageMedium(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return cloneUUID, nil
+}
+
+// Clone the machine and add the clone, along with its disks, to the maps.
+// Only registered clones can be found to be decoded.
+func (vbox *VirtualBox) Clone(machine *Machine, options CloneMachine) (*Machine, error) {
+	return vbox.CloneContext(context.Background(), machine, options)
+}
+
+// Clone the machine and add it to the maps, killing VBoxManage if the
+// context is done first.
+func (vbox *VirtualBox) CloneContext(ctx context.Context, machine *Machine, options CloneMachine) (*Machine, error) {
+	if !options.Register {
+		return nil, errors.New("virtualbox: only registered clones can be decoded")
+	}
+	cloneUUID, err := machine.CloneContext(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	found, _, err := showMachine(ctx, cloneUUID.String())
+	if err != nil {
+		return nil, err
+	}
+	clone, media, err := decodeMachineFile(cloneUUID, found.Source)
+	if err != nil {
+		return nil, err
+	}
+	vbox.add(clone, media)
+	return clone, nil
+}
@@ -0,0 +1,132 @@
+package virtualbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// The settings that make up the identity of a machine configuration, leaving
+// out where it is stored, its state, MAC addresses and which disk images it
+// uses so that machines created from the same spec compare equal.
+type machineSettings struct {
+	Name               string
+	OSType             OSType
+	Groups             []string
+	Architecture       string
+	CPUs               int
+	CPUHotPlug         bool
+	CPUCap             int
+	PluggedCPUs        []int
+	Memory             int
+	Firmware           Firmware
+	BIOSTimeOffset     time.Duration
+	BootMenu           BootMenuMode
+	BootLogo           *BootLogo
+	BootOrder          []BootDevice
+	TPM                TPMType
+	Chipset            Chipset
+	IOAPIC             bool
+	HPET               bool
+	RTCUseUTC          bool
+	Frontend           Frontend
+	Audio              bool
+	VRAM               int
+	NestedPaging       bool
+	PAE                bool
+	USB                USBController
+	VRDEEnabled        bool
+	VRDEPort           Port
+	VRDEAuthType       VRDEAuthType
+	Forwards           []PortForward
+	StorageControllers []StorageController
+	NetworkAdapters    []NetworkAdapter
+}
+
+func (machine *Machine) settings() *machineSettings {
+	settings := &machineSettings{
+		Name:           machine.Name,
+		OSType:         machine.OSType,
+		Groups:         append([]string(nil), machine.Groups...),
+		Architecture:   machine.Architecture,
+		CPUs:           machine.CPUs,
+		CPUHotPlug:     machine.CPUHotPlug,
+		CPUCap:         machine.CPUCap,
+		PluggedCPUs:    append([]int(nil), machine.PluggedCPUs...),
+		Memory:         machine.Memory,
+		Firmware:       machine.Firmware,
+		BIOSTimeOffset: machine.BIOSTimeOffset,
+		BootMenu:       machine.BootMenu,
+		BootLogo:       machine.BootLogo,
+		BootOrder:      append([]BootDevice(nil), machine.BootOrder...),
+		TPM:            machine.TPM,
+		Chipset:        machine.Chipset,
+		IOAPIC:         machine.IOAPIC,
+		HPET:           machine.HPET,
+		RTCUseUTC:      machine.RTCUseUTC,
+		Frontend:       machine.Frontend,
+		Audio:          machine.Audio,
+		VRAM:           machine.VRAM,
+		NestedPaging:   machine.NestedPaging,
+		PAE:            machine.PAE,
+		USB:            machine.USB,
+		VRDEEnabled:    machine.VRDEEnabled,
+		VRDEPort:       machine.VRDEPort,
+		Forwards:       append([]PortForward(nil), machine.Forwards...),
+	}
+	if machine.VRDE != nil {
+		settings.VRDEAuthType = machine.VRDE.AuthType
+	}
+	sort.Strings(settings.Groups)
+	sort.Ints(settings.PluggedCPUs)
+	sort.Slice(settings.Forwards, func(i, j int) bool {
+		return settings.Forwards[i].Name < settings.Forwards[j].Name
+	})
+	for _, controller := range machine.StorageControllers {
+		copied := *controller
+		copied.Devices = make([]AttachedDevice, len(controller.Devices))
+		for index, device := range controller.Devices {
+			device.Medium = nil
+			copied.Devices[index] = device
+		}
+		sort.Slice(copied.Devices, func(i, j int) bool {
+			a, b := copied.Devices[i], copied.Devices[j]
+			return a.Port < b.Port || a.Port == b.Port && a.Device < b.Device
+		})
+		settings.StorageControllers = append(settings.StorageControllers, copied)
+	}
+	sort.Slice(settings.StorageControllers, func(i, j int) bool {
+		return settings.StorageControllers[i].Name < settings.StorageControllers[j].Name
+	})
+	for _, adapter := range machine.NetworkAdapters {
+		copied := *adapter
+		copied.MACAddress = ""
+		copied.Forwards = nil // already part of Forwards
+		settings.NetworkAdapters = append(settings.NetworkAdapters, copied)
+	}
+	sort.Slice(settings.NetworkAdapters, func(i, j int) bool {
+		return settings.NetworkAdapters[i].Slot < settings.NetworkAdapters[j].Slot
+	})
+	return settings
+}
+
+// Get a stable hash of the significant settings of the machine. The UUID,
+// settings file, state and attached disk images are not included, and the
+// order of groups, forwarding rules and storage devices does not matter.
+func (machine *Machine) ConfigHash() string {
+	// the settings are plain values, which always marshal
+	data, _ := json.Marshal(machine.settings())
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Check if both machines have the same significant settings, as compared by
+// ConfigHash.
+func (machine *Machine) Equal(other *Machine) bool {
+	if machine == nil || other == nil {
+		return machine == other
+	}
+	return machine.ConfigHash() == other.ConfigHash()
+}
@@ -0,0 +1,200 @@
+package virtualbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A network the machines of a compose manifest are attached to.
+type ComposeNetwork struct {
+	Mode NetworkMode // NetworkInternal if empty
+	// The host interface for NetworkHostOnly and NetworkBridged, or the
+	// network name for NetworkInternal and NetworkNATNetwork, which
+	// defaults to the manifest and network names joined by a dash.
+	Interface string `json:",omitempty"`
+}
+
+// A machine of a compose manifest. Its first adapter stays NAT for the
+// forwards, and the networks are attached to the following adapters.
+type ComposeMachine struct {
+	MachineSpec
+	Networks      []string       `json:",omitempty"` // keys of the manifest networks
+	SharedFolders []SharedFolder `json:",omitempty"`
+	DependsOn     []string       `json:",omitempty"` // machine names started first
+}
+
+// Describes an environment of machines, the docker-compose way.
+type ComposeManifest struct {
+	Name     string                    // the group the machines are created in
+	Networks map[string]ComposeNetwork `json:",omitempty"`
+	Machines []ComposeMachine
+}
+
+// Read a compose manifest from JSON and check that the networks and
+// dependencies it refers to are defined.
+func ParseComposeManifest(r io.Reader) (*ComposeManifest, error) {
+	manifest := new(ComposeManifest)
+	err := json.NewDecoder(r).Decode(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, manifest.validate()
+}
+
+func (manifest *ComposeManifest) validate() error {
+	seen := make(map[string]bool, len(manifest.Machines))
+	for _, machine := range manifest.Machines {
+		if seen[machine.Name] {
+			return fmt.Errorf("virtualbox: machine %s is defined twice", machine.Name)
+		}
+		seen[machine.Name] = true
+		for _, network := range machine.Networks {
+			if _, found := manifest.Networks[network]; !found {
+				return fmt.Errorf("virtualbox: machine %s uses undefined network %s", machine.Name, network)
+			}
+		}
+	}
+	_, err := manifest.tiers()
+	return err
+}
+
+// Get the machine names in start order, grouped by tiers.
+func (manifest *ComposeManifest) tiers() ([][]*Machine, error) {
+	machines := make([]*Machine, len(manifest.Machines))
+	for index, machine := range manifest.Machines {
+		machines[index] = &Machine{Name: machine.Name}
+	}
+	return startTiers(machines, manifest.deps())
+}
+
+func (manifest *ComposeManifest) deps() map[string][]string {
+	deps := make(map[string][]string)
+	for _, machine := range manifest.Machines {
+		if len(machine.DependsOn) != 0 {
+			deps[machine.Name] = machine.DependsOn
+		}
+	}
+	return deps
+}
+
+// Get the adapter attaching to the network.
+func (manifest *ComposeManifest) adapter(slot int, name string) NetworkAdapter {
+	network := manifest.Networks[name]
+	adapter := NetworkAdapter{Slot: slot, Mode: network.Mode}
+	if adapter.Mode == "" {
+		adapter.Mode = NetworkInternal
+	}
+	networkName := network.Interface
+	if networkName == "" {
+		networkName = name
+		if manifest.Name != "" {
+			networkName = manifest.Name + "-" + name
+		}
+	}
+	switch adapter.Mode {
+	case NetworkHostOnly:
+		adapter.HostOnlyInterface = networkName
+	case NetworkBridged:
+		adapter.BridgedInterface = networkName
+	case NetworkNATNetwork:
+		adapter.NATNetwork = networkName
+	default:
+		adapter.InternalNetwork = networkName
+	}
+	return adapter
+}
+
+// Create the machine with its networks and shared folders, destroying it
+// again if configuring it fails so that the next ComposeUp starts over.
+func (manifest *ComposeManifest) create(ctx context.Context, composed ComposeMachine) (*Machine, error) {
+	spec := composed.MachineSpec
+	if manifest.Name != "" {
+		spec.Groups = append([]string{"/" + manifest.Name}, spec.Groups...)
+	}
+	machine, err := spec.Create()
+	if err == nil {
+		for index, network := range composed.Networks {
+			err = machine.SetNetworkAdapter(manifest.adapter(index+2, network))
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		for _, folder := range composed.SharedFolders {
+			err = machine.AddSharedFolder(folder.Name, folder.HostPath, folder.Writable, folder.AutoMount)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil && machine != nil {
+		err = errors.Join(err, machine.Destroy(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("virtualbox: creating %s: %w", composed.Name, err)
+	}
+	return machine, nil
+}
+
+// Bring up the environment: create the missing machines, update the memory,
+// CPUs and forwards of existing ones with ApplySpec, and start them with
+// StartGroup in dependency order. Networks and shared folders are only
+// configured when a machine is created. NAT networks and host-only
+// interfaces must already exist.
+func ComposeUp(ctx context.Context, manifest *ComposeManifest, opts ...StartGroupOption) error {
+	err := manifest.validate()
+	if err != nil {
+		return err
+	}
+	machines := make([]*Machine, 0, len(manifest.Machines))
+	for _, composed := range manifest.Machines {
+		machine, err := LoadMachine(composed.Name)
+		switch {
+		case errors.Is(err, ErrMachineNotFound):
+			machine, err = manifest.create(ctx, composed)
+			if err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			_, err = machine.ApplySpec(composed.MachineSpec)
+			if err != nil {
+				return fmt.Errorf("virtualbox: updating %s: %w", composed.Name, err)
+			}
+		}
+		machines = append(machines, machine)
+	}
+	return StartGroup(ctx, machines, manifest.deps(), opts...)
+}
+
+// Tear down the environment, powering off and deleting the machines along
+// with their disks, dependents before their dependencies. Machines that do
+// not exist are skipped, and failures do not stop the others from being
+// removed.
+func ComposeDown(ctx context.Context, manifest *ComposeManifest) error {
+	tiers, err := manifest.tiers()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for index := len(tiers) - 1; index >= 0; index-- {
+		for _, named := range tiers[index] {
+			machine, err := LoadMachine(named.Name)
+			if errors.Is(err, ErrMachineNotFound) {
+				continue
+			}
+			if err == nil {
+				err = machine.Destroy(ctx)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("virtualbox: removing %s: %w", named.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package virtualbox
+
+import (
+	"context"
+)
+
+type ClipboardMode string
+
+const (
+	ClipboardDisabled      = ClipboardMode("disabled")
+	ClipboardHostToGuest   = ClipboardMode("hosttoguest")
+	ClipboardGuestToHost   = ClipboardMode("guesttohost")
+	ClipboardBidirectional = ClipboardMode("bidirectional")
+)
+
+type DragAndDropMode string
+
+const (
+	DragAndDropDisabled      = DragAndDropMode("disabled")
+	DragAndDropHostToGuest   = DragAndDropMode("hosttoguest")
+	DragAndDropGuestToHost   = DragAndDropMode("guesttohost")
+	DragAndDropBidirectional = DragAndDropMode("bidirectional")
+)
+
+// Run a controlvm subcommand against the running machine.
+func (machine *Machine) controlVM(args ...string) error {
+	return machine.controlVMContext(context.Background(), args...)
+}
+
+func (machine *Machine) controlVMContext(ctx context.Context, args ...string) error {
+	_, err := machine.manage(ctx,
+		append([]string{"controlvm", machine.UUID.String()}, args...)...)
+	return err
+}
+
+// Pause the running machine.
+func (machine *Machine) Pause() error {
+	err := machine.controlVM("pause")
+	if err != nil {
+		return err
+	}
+	machine.Status = Paused
+	return nil
+}
+
+// Resume the paused machine.
+func (machine *Machine) Resume() error {
+	err := machine.controlVM("resume")
+	if err != nil {
+		return err
+	}
+	machine.Status = Running
+	return nil
+}
+
+// Save the state of the running machine to disk and stop it.
+func (machine *Machine) SaveState() error {
+	err := machine.controlVM("savestate")
+	if err != nil {
+		return err
+	}
+	machine.Status = Saved
+	return nil
+}
+
+// Discard the saved state of the machine, so the next start boots the guest
+// from scratch as after a power off.
+func (machine *Machine) DiscardState() error {
+	_, err := machine.manage(context.Background(), "discardstate", machine.UUID.String())
+	if err != nil {
+		return err
+	}
+	machine.Status = Off
+	return nil
+}
+
+// Reset the running machine like pressing the reset button, without
+// letting the guest shut down.
+func (machine *Machine) Reset() error {
+	err := machine.controlVM("reset")
+	if err != nil {
+		return err
+	}
+	machine.Status = Running
+	return nil
+}
+
+// Change the shared clipboard mode of the running machine.
+func (machine *Machine) SetClipboardMode(mode ClipboardMode) error {
+	return machine.controlVM("clipboard", "mode", string(mode))
+}
+
+// Change the drag and drop mode of the running machine.
+func (machine *Machine) SetDragAndDropMode(mode DragAndDropMode) error {
+	return machine.controlVM("draganddrop", string(mode))
+}
+
+// Turn the VRDE server of the running machine on or off.
+func (machine *Machine) SetVRDEEnabled(enabled bool) error {
+	state := "off"
+	if enabled {
+		state = "on"
+	}
+	err := machine.controlVM("vrde", state)
+	if err != nil {
+		return err
+	}
+	machine.VRDEEnabled = enabled
+	return nil
+}
+
+// Change the VRDE port of the running machine.
+func (machine *Machine) SetVRDEPort(port Port) error {
+	err := port.validateHost()
+	if err != nil {
+		return err
+	}
+	err = machine.controlVM("vrdeport", port.String())
+	if err != nil {
+		return err
+	}
+	machine.VRDEPort = port
+	return nil
+}
@@ -0,0 +1,215 @@
+package virtualbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	VMDK  = HardDiskFormat("VMDK")  // VMware, and with VariantStream OVF and cloud uploads
+	VHD   = HardDiskFormat("VHD")   // Hyper-V and Azure
+	VHDX  = HardDiskFormat("VHDX")  // needs qemu-img
+	QCOW2 = HardDiskFormat("QCOW2") // needs qemu-img
+)
+
+// The qemu-img command ConvertTo falls back to for formats VBoxManage
+// cannot write, such as VHDX and QCOW2. Empty disables the fallback.
+var QemuImg string
+
+// Formats clonemedium can write.
+var vboxManageWritableFormats = map[HardDiskFormat]bool{
+	VDI:   true,
+	VMDK:  true,
+	VHD:   true,
+	"RAW": true,
+}
+
+// qemu-img names of the formats it can convert to.
+var qemuImgFormats = map[HardDiskFormat]string{
+	VDI:   "vdi",
+	VMDK:  "vmdk",
+	VHD:   "vpc",
+	VHDX:  "vhdx",
+	QCOW2: "qcow2",
+	"RAW": "raw",
+}
+
+var (
+	conversionPercent = regexp.MustCompile(`(\d+)%`)
+	qemuImgPercent    = regexp.MustCompile(`\((\d+)(?:\.\d+)?/100%\)`)
+	qemuImgSupported  = regexp.MustCompile(`(?m)^Supported formats:(.*)$`)
+)
+
+// Reports the progress VBoxManage or qemu-img write, such as "0%...10%...",
+// while keeping everything for the error message.
+type progressWriter struct {
+	output   bytes.Buffer
+	pattern  *regexp.Regexp
+	percent  int
+	progress func(percent int)
+}
+
+func (writer *progressWriter) Write(data []byte) (int, error) {
+	writer.output.Write(data)
+	// the output is short, and scanning it all copes with split writes
+	for _, match := range writer.pattern.FindAllSubmatch(writer.output.Bytes(), -1) {
+		percent, _ := strconv.Atoi(string(match[1]))
+		if percent > writer.percent && writer.progress != nil {
+			writer.percent = percent
+			writer.progress(percent)
+		}
+	}
+	return len(data), nil
+}
+
+// Write a copy of the disk image, along with the differencing images below
+// it, in the format to dst, for use with other hypervisors. Formats that
+// VBoxManage cannot write, such as VHDX for Hyper-V and QCOW2 for KVM, are
+// converted with QemuImg if set, which only handles base images. A copy
+// made by VBoxManage is unregistered again, leaving only the file. The
+// machine using the disk should be off.
+func (disk *HardDisk) ConvertTo(format HardDiskFormat, dst string) error {
+	return disk.ConvertToContext(context.Background(), format, VariantStandard, dst, nil)
+}
+
+// Convert the disk image like ConvertTo with the variant, such as
+// VariantStream for a stream-optimized VMDK, calling progress with the
+// percentage done as it increases. The conversion is killed if the context
+// is done first.
+func (disk *HardDisk) ConvertToContext(ctx context.Context, format HardDiskFormat, variant DiskVariant, dst string, progress func(percent int)) error {
+	if ReadOnly {
+		return ErrReadOnly
+	}
+	if vboxManageWritableFormats[format] {
+		return disk.cloneTo(ctx, format, variant, dst, progress)
+	}
+	if QemuImg == "" {
+		return fmt.Errorf("virtualbox: VBoxManage cannot write %s images, set QemuImg to use qemu-img", format)
+	}
+	return disk.qemuImgConvert(ctx, format, variant, dst, progress)
+}
+
+// Convert the disk image with clonemedium.
+func (disk *HardDisk) cloneTo(ctx context.Context, format HardDiskFormat, variant DiskVariant, dst string, progress func(percent int)) error {
+	release, err := acquireMediumSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	releaseCommand, err := acquireCommandSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer releaseCommand()
+
+	args := []string{"clonemedium", "disk", disk.UUID.String(), dst, "--format", string(format)}
+	if variant != "" {
+		args = append(args, "--variant", string(variant))
+	}
+	spanCtx, endSpan := startSpan(ctx, "VBoxManage", commandAttributes(args))
+	var stdout bytes.Buffer
+	stderr := &progressWriter{pattern: conversionPercent, progress: progress}
+	command := vboxManageCommand(spanCtx, MediumPriority.wrapper(), args...)
+	command.Stdout, command.Stderr = &stdout, stderr
+	err = command.Run()
+	err = commandError(args, stderr.output.Bytes(), err)
+	endSpan(err)
+	if err != nil {
+		return err
+	}
+
+	uuids := extractUUIDs(stdout.String())
+	if len(uuids) != 1 {
+		return errors.New("virtualbox: clonemedium did not report the UUID")
+	}
+	_, err = vboxManageModifyContext(ctx, "closemedium", "disk", uuids[0].String())
+	return err
+}
+
+// Get the formats the installed QemuImg supports, from its help output.
+func qemuImgFormatsSupported(ctx context.Context) (map[string]bool, error) {
+	bytes, err := newCommand(ctx, QemuImg, "--help").Output()
+	if err != nil {
+		return nil, fmt.Errorf("virtualbox: running %s: %w", QemuImg, err)
+	}
+	match := qemuImgSupported.FindSubmatch(bytes)
+	if match == nil {
+		return nil, fmt.Errorf("virtualbox: %s does not list its supported formats", QemuImg)
+	}
+	supported := make(map[string]bool)
+	for _, name := range strings.Fields(string(match[1])) {
+		supported[name] = true
+	}
+	return supported, nil
+}
+
+// Get the qemu-img -o options for the variant of the format.
+func qemuImgOptions(format HardDiskFormat, variant DiskVariant) (string, error) {
+	switch {
+	case variant == "" || variant == VariantStandard:
+		return "", nil
+	case variant == VariantStream && format == VMDK:
+		return "subformat=streamOptimized", nil
+	case variant == VariantFixed && format == VMDK:
+		return "subformat=monolithicFlat", nil
+	case variant == VariantFixed && (format == VHD || format == VHDX):
+		return "subformat=fixed", nil
+	case variant == VariantFixed && format == QCOW2:
+		return "preallocation=full", nil
+	}
+	return "", fmt.Errorf("virtualbox: qemu-img cannot write %s images as %s", format, variant)
+}
+
+// Convert the disk image with qemu-img after checking it can read the
+// source and write the format.
+func (disk *HardDisk) qemuImgConvert(ctx context.Context, format HardDiskFormat, variant DiskVariant, dst string, progress func(percent int)) (err error) {
+	if disk.Parent != nil {
+		return errors.New("virtualbox: qemu-img cannot follow differencing images, convert the base image")
+	}
+	source, target := libvirtDiskFormats[disk.Format], qemuImgFormats[format]
+	if target == "" {
+		return fmt.Errorf("virtualbox: neither VBoxManage nor qemu-img can write %s images", format)
+	}
+	options, err := qemuImgOptions(format, variant)
+	if err != nil {
+		return err
+	}
+	supported, err := qemuImgFormatsSupported(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported[target] {
+		return fmt.Errorf("virtualbox: neither VBoxManage nor %s can write %s images", QemuImg, format)
+	}
+	if source == "" || !supported[source] {
+		return fmt.Errorf("virtualbox: %s cannot read %s images", QemuImg, disk.Format)
+	}
+
+	release, err := acquireMediumSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	args := []string{"convert", "-p", "-f", source, "-O", target}
+	if options != "" {
+		args = append(args, "-o", options)
+	}
+	args = append(args, disk.Location, dst)
+	ctx, endSpan := startSpan(ctx, "qemu-img", map[string]string{TraceCommand: "convert"})
+	defer func() { endSpan(err) }()
+	command := append(MediumPriority.wrapper(), QemuImg)
+	command = append(command, args...)
+	var stderr bytes.Buffer
+	cmd := newCommand(ctx, command[0], command[1:]...)
+	cmd.Stdout, cmd.Stderr = &progressWriter{pattern: qemuImgPercent, progress: progress}, &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("virtualbox: %s convert: %w: %s", QemuImg, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
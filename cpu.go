@@ -0,0 +1,66 @@
+package virtualbox
+
+import (
+	"strconv"
+)
+
+type CPUTopology struct {
+	Configured   int  // maximum number of CPUs
+	Current      int  // CPUs currently plugged in
+	ExecutionCap int  // percentage of host CPU time each virtual CPU may use
+	HotPlug      bool // CPUs can be plugged and unplugged while running
+}
+
+// Get the CPU topology from the decoded settings. Without hot plug all
+// configured CPUs are present, so capping the execution is the only way to
+// scale a running machine down.
+func (machine *Machine) CPUTopology() CPUTopology {
+	topology := CPUTopology{
+		Configured:   machine.CPUs,
+		Current:      machine.CPUs,
+		ExecutionCap: machine.CPUCap,
+		HotPlug:      machine.CPUHotPlug,
+	}
+	if machine.CPUHotPlug && len(machine.PluggedCPUs) != 0 {
+		topology.Current = len(machine.PluggedCPUs)
+	}
+	return topology
+}
+
+// Limit the host CPU time available to each virtual CPU of the running
+// machine, as a percentage.
+func (machine *Machine) SetCPUExecutionCap(percent int) error {
+	err := machine.controlVM("cpuexecutioncap", strconv.Itoa(percent))
+	if err != nil {
+		return err
+	}
+	machine.CPUCap = percent
+	return nil
+}
+
+// Add a CPU to the running machine. Requires CPU hot plug.
+func (machine *Machine) PlugCPU(id int) error {
+	err := machine.controlVM("plugcpu", strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	machine.PluggedCPUs = append(machine.PluggedCPUs, id)
+	return nil
+}
+
+// Remove a CPU from the running machine. Requires CPU hot plug and CPU 0
+// cannot be removed.
+func (machine *Machine) UnplugCPU(id int) error {
+	err := machine.controlVM("unplugcpu", strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	for index, plugged := range machine.PluggedCPUs {
+		if plugged == id {
+			machine.PluggedCPUs = append(
+				machine.PluggedCPUs[:index], machine.PluggedCPUs[index+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Package crud exposes machines as resources with flat Create, Read,
+// Update and Delete functions over MachineSpec, the shape infrastructure
+// tools such as Terraform providers expect.
+//
+// The ID of a machine is its UUID, which stays the same across renames and
+// restarts of VirtualBox. Existing machines are brought under management
+// with Import.
+package crud
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	virtualbox "github.com/daaku/go.virtualbox"
+	uuid "github.com/daaku/gouuid"
+)
+
+// A difference between the current and the desired spec of a machine.
+type Change struct {
+	Field    string // the name of the MachineSpec field
+	ForceNew bool   // the machine has to be replaced to apply it
+}
+
+// Create the machine and get its ID. An ID is also returned when setting
+// up the created machine failed, so the caller can track and delete it.
+func Create(spec virtualbox.MachineSpec) (string, error) {
+	machine, err := spec.Create()
+	if machine == nil {
+		return "", err
+	}
+	return machine.UUID.String(), err
+}
+
+// Get the spec of the machine. Machines that were deleted outside of the
+// caller result in virtualbox.ErrMachineNotFound. The BaseFolder is only
+// used when creating a machine and is not read back.
+func Read(id string) (*virtualbox.MachineSpec, error) {
+	machineUUID, err := uuid.ParseHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("virtualbox: invalid machine ID %q", id)
+	}
+	configPath, err := virtualbox.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	vbox, err := virtualbox.Decode(configPath)
+	if err != nil {
+		return nil, err
+	}
+	machine := vbox.Machines[*machineUUID]
+	if machine == nil {
+		return nil, virtualbox.ErrMachineNotFound
+	}
+
+	spec := &virtualbox.MachineSpec{
+		Name:     machine.Name,
+		OSType:   machine.OSType,
+		Memory:   machine.Memory,
+		CPUs:     machine.CPUs,
+		Groups:   machine.Groups,
+		Forwards: machine.Forwards,
+	}
+	if controller := machine.StorageController("SATA"); controller != nil {
+		for _, device := range controller.Devices {
+			if device.Port != 0 || device.Device != 0 || device.Medium == nil {
+				continue
+			}
+			// snapshots attach differencing disks on top of the base image
+			disk := vbox.HardDisks[*device.Medium]
+			for disk != nil && disk.Parent != nil && vbox.HardDisks[*disk.Parent] != nil {
+				disk = vbox.HardDisks[*disk.Parent]
+			}
+			if disk != nil {
+				spec.BaseImage = disk.Location
+			}
+		}
+	}
+	return spec, nil
+}
+
+// Get the changes needed to turn the current spec, as returned by Read,
+// into the desired one. Zero Memory and CPUs in the desired spec are left
+// to VirtualBox, and the BaseFolder is not compared.
+func Diff(current, desired virtualbox.MachineSpec) []Change {
+	var changes []Change
+	if current.Name != desired.Name {
+		changes = append(changes, Change{Field: "Name", ForceNew: true})
+	}
+	if current.OSType != desired.OSType {
+		changes = append(changes, Change{Field: "OSType", ForceNew: true})
+	}
+	if desired.Memory != 0 && current.Memory != desired.Memory {
+		changes = append(changes, Change{Field: "Memory"})
+	}
+	if desired.CPUs != 0 && current.CPUs != desired.CPUs {
+		changes = append(changes, Change{Field: "CPUs"})
+	}
+	if current.BaseImage != desired.BaseImage {
+		changes = append(changes, Change{Field: "BaseImage", ForceNew: true})
+	}
+	if !sameGroups(current.Groups, desired.Groups) {
+		changes = append(changes, Change{Field: "Groups", ForceNew: true})
+	}
+	if !sameForwards(current.Forwards, desired.Forwards) {
+		changes = append(changes, Change{Field: "Forwards"})
+	}
+	return changes
+}
+
+// Machines without groups are in the root group.
+func sameGroups(a, b []string) bool {
+	a, b = sortedGroups(a), sortedGroups(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedGroups(groups []string) []string {
+	if len(groups) == 0 {
+		return []string{"/"}
+	}
+	groups = append([]string(nil), groups...)
+	sort.Strings(groups)
+	return groups
+}
+
+func forwardsByName(forwards []virtualbox.PortForward) map[string]virtualbox.PortForward {
+	byName := make(map[string]virtualbox.PortForward, len(forwards))
+	for _, forward := range forwards {
+		if forward.Protocol == "" {
+			forward.Protocol = virtualbox.TCP
+		}
+		byName[forward.Name] = forward
+	}
+	return byName
+}
+
+func sameForwards(a, b []virtualbox.PortForward) bool {
+	byName := forwardsByName(a)
+	if len(byName) != len(b) {
+		return false
+	}
+	for name, forward := range forwardsByName(b) {
+		if byName[name] != forward {
+			return false
+		}
+	}
+	return true
+}
+
+// Bring the machine in line with the spec. Changes Diff marks ForceNew are
+// refused, the caller has to delete and create the machine instead. The
+// machine has to be off for the changes to apply.
+func Update(id string, spec virtualbox.MachineSpec) error {
+	current, err := Read(id)
+	if err != nil {
+		return err
+	}
+	for _, change := range Diff(*current, spec) {
+		if change.ForceNew {
+			return fmt.Errorf("virtualbox: changing %s of machine %s needs a new machine",
+				change.Field, current.Name)
+		}
+	}
+	machine, err := virtualbox.LoadMachine(id)
+	if err != nil {
+		return err
+	}
+	_, err = machine.ApplySpec(spec)
+	if err != nil {
+		return err
+	}
+	wanted := forwardsByName(spec.Forwards)
+	for _, forward := range current.Forwards {
+		if _, found := wanted[forward.Name]; found {
+			continue
+		}
+		err = machine.RemovePortForward(forward.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Power off the machine if needed and delete it along with its disks.
+// Deleting a machine that no longer exists is not an error.
+func Delete(id string) error {
+	_, err := Read(id)
+	if err == virtualbox.ErrMachineNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	machine, err := virtualbox.LoadMachine(id)
+	if err != nil {
+		return err
+	}
+	return machine.Destroy(context.Background())
+}
+
+// Get the ID of an existing machine by name or UUID, to manage it from
+// then on.
+func Import(nameOrUUID string) (string, error) {
+	machine, err := virtualbox.LoadMachine(nameOrUUID)
+	if err != nil {
+		return "", err
+	}
+	return machine.UUID.String(), nil
+}
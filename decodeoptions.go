@@ -0,0 +1,94 @@
+package virtualbox
+
+import (
+	"encoding/xml"
+	"errors"
+	"regexp"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Returned by Decode with WithOnlyRunning when it cannot tell which machines
+// are running, in Offline mode or without a working StatusSource.
+var ErrStatusUnknown = errors.New("virtualbox: running machines are unknown")
+
+// Limits the machines decoded by Decode.
+type DecodeOption func(*decodeOptions)
+
+type decodeOptions struct {
+	name        *regexp.Regexp
+	group       string
+	onlyRunning bool
+}
+
+// Only decode machines whose name matches the expression.
+func WithNameFilter(re *regexp.Regexp) DecodeOption {
+	return func(options *decodeOptions) {
+		options.name = re
+	}
+}
+
+// Only decode machines in the group or one of its subgroups.
+func WithGroupFilter(group string) DecodeOption {
+	return func(options *decodeOptions) {
+		options.group = group
+	}
+}
+
+// Only decode running machines. Machines are filtered by UUID before their
+// settings files are read.
+func WithOnlyRunning() DecodeOption {
+	return func(options *decodeOptions) {
+		options.onlyRunning = true
+	}
+}
+
+// The attributes needed for filtering by name and group, which are much
+// cheaper to decode than the whole machine.
+type xmlMachineHeader struct {
+	Name   string     `xml:"name,attr"`
+	Groups []xmlGroup `xml:"Groups>Group"`
+}
+
+type xmlMachineHeaderRoot struct {
+	Machines []xmlMachineHeader `xml:"Machine"`
+}
+
+// Check if a machine with the UUID should be decoded before reading its
+// settings file.
+func (options *decodeOptions) matchUUID(machineUUID string, running map[uuid.UUID]bool) bool {
+	if options == nil || !options.onlyRunning {
+		return true
+	}
+	parsed, err := uuid.ParseHex(machineUUID)
+	return err == nil && running[*parsed]
+}
+
+// Check if the machine in the settings should be decoded.
+func (options *decodeOptions) matchSettings(data []byte) (bool, error) {
+	if options == nil || options.name == nil && options.group == "" {
+		return true, nil
+	}
+	root := new(xmlMachineHeaderRoot)
+	err := xml.Unmarshal(data, root)
+	if err != nil {
+		return false, err
+	}
+	if len(root.Machines) != 1 {
+		return false, errors.New("Was expecting exactly 1 machine.")
+	}
+	header := root.Machines[0]
+	if options.name != nil && !options.name.MatchString(header.Name) {
+		return false, nil
+	}
+	if options.group != "" {
+		groups := make([]string, 0, len(header.Groups))
+		for _, group := range header.Groups {
+			groups = append(groups, group.Name)
+		}
+		if !inGroup(groups, options.group) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !freebsd && !linux
+
+package virtualbox
+
+import "errors"
+
+// Free space detection is not implemented on this platform.
+func freeBytes(dir string) (int64, error) {
+	return 0, errors.New("virtualbox: free space detection not supported on this platform")
+}
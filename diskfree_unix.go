@@ -0,0 +1,16 @@
+//go:build darwin || freebsd || linux
+
+package virtualbox
+
+import "syscall"
+
+// Get the number of bytes available to unprivileged users on the volume
+// containing dir.
+func freeBytes(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
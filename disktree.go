@@ -0,0 +1,109 @@
+package virtualbox
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Get the disks used by the machine, including the whole differencing
+// chains its attached disks are part of.
+func (vbox *VirtualBox) MachineHardDisks(machine *Machine) HardDiskMap {
+	disks := make(HardDiskMap)
+	for _, disk := range vbox.machineDiskTree(machine) {
+		disks[disk.UUID] = disk
+	}
+	return disks
+}
+
+// Get the disks without a parent in the map, ordered by location.
+func (hardDisks HardDiskMap) roots() []*HardDisk {
+	var roots []*HardDisk
+	for _, disk := range hardDisks {
+		if disk.Parent == nil || hardDisks[*disk.Parent] == nil {
+			roots = append(roots, disk)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Location < roots[j].Location
+	})
+	return roots
+}
+
+func (hardDisks HardDiskMap) children(disk *HardDisk) []*HardDisk {
+	var children []*HardDisk
+	for _, child := range disk.Children {
+		if childDisk := hardDisks[*child]; childDisk != nil {
+			children = append(children, childDisk)
+		}
+	}
+	return children
+}
+
+// Get the format and, when set, the type of the disk.
+func (disk *HardDisk) kind() string {
+	if disk.Type == "" {
+		return string(disk.Format)
+	}
+	return string(disk.Format) + " " + string(disk.Type)
+}
+
+func (disk *HardDisk) describe() string {
+	return fmt.Sprintf("%s (%s) %s", disk.Location, disk.kind(), disk.UUID.String())
+}
+
+// Render the differencing chains as an indented tree, one disk per line.
+func (hardDisks HardDiskMap) Tree() string {
+	var tree strings.Builder
+	var walk func(disk *HardDisk, prefix string, last bool)
+	walk = func(disk *HardDisk, prefix string, last bool) {
+		branch, indent := "├── ", "│   "
+		if last {
+			branch, indent = "└── ", "    "
+		}
+		tree.WriteString(prefix + branch + disk.describe() + "\n")
+		children := hardDisks.children(disk)
+		for index, child := range children {
+			walk(child, prefix+indent, index == len(children)-1)
+		}
+	}
+	for _, root := range hardDisks.roots() {
+		tree.WriteString(root.describe() + "\n")
+		children := hardDisks.children(root)
+		for index, child := range children {
+			walk(child, "", index == len(children)-1)
+		}
+	}
+	return tree.String()
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// Write the differencing chains as a Graphviz digraph with an edge from
+// every parent to its children.
+func (hardDisks HardDiskMap) WriteDOT(w io.Writer) error {
+	var dot strings.Builder
+	dot.WriteString("digraph disks {\n\tnode [shape=box];\n")
+	var write func(disk *HardDisk)
+	write = func(disk *HardDisk) {
+		id := disk.UUID.String()
+		label := filepath.Base(disk.Location) + "\n" + disk.kind()
+		fmt.Fprintf(&dot, "\t%s [label=%s];\n", dotQuote(id), dotQuote(label))
+		for _, child := range hardDisks.children(disk) {
+			fmt.Fprintf(&dot, "\t%s -> %s;\n", dotQuote(id), dotQuote(child.UUID.String()))
+			write(child)
+		}
+	}
+	for _, root := range hardDisks.roots() {
+		write(root)
+	}
+	dot.WriteString("}\n")
+	_, err := io.WriteString(w, dot.String())
+	return err
+}
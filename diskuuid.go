@@ -0,0 +1,112 @@
+package virtualbox
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Returned when changing the UUIDs stored in an image VirtualBox has
+// registered, which would make the registration refer to a missing disk.
+var ErrDiskRegistered = errors.New("virtualbox: disk is registered, close it with closemedium first")
+
+// Disk images registered with the same UUID. This happens when images are
+// copied outside of VirtualBox, and VirtualBox refuses to open the copies.
+type DiskUUIDConflict struct {
+	UUID      uuid.UUID
+	Locations []string
+}
+
+// Add the disks of a machine, recording UUIDs already used by a disk at
+// another location.
+func (vbox *VirtualBox) mergeHardDisks(disks HardDiskMap) {
+	for diskUUID, disk := range disks {
+		if known := vbox.HardDisks[diskUUID]; known != nil && known.Location != disk.Location {
+			if vbox.diskConflicts == nil {
+				vbox.diskConflicts = make(map[uuid.UUID][]string)
+			}
+			if len(vbox.diskConflicts[diskUUID]) == 0 {
+				vbox.diskConflicts[diskUUID] = []string{known.Location}
+			}
+			vbox.diskConflicts[diskUUID] = append(vbox.diskConflicts[diskUUID], disk.Location)
+			continue
+		}
+		vbox.HardDisks[diskUUID] = disk
+	}
+}
+
+// Get the UUIDs Decode found registered for more than one image, ordered by
+// the first location. The maps only hold the first image found.
+func (vbox *VirtualBox) DiskUUIDConflicts() []DiskUUIDConflict {
+	vbox.mutex.RLock()
+	defer vbox.mutex.RUnlock()
+	conflicts := make([]DiskUUIDConflict, 0, len(vbox.diskConflicts))
+	for diskUUID, locations := range vbox.diskConflicts {
+		conflicts = append(conflicts, DiskUUIDConflict{
+			UUID:      diskUUID,
+			Locations: append([]string(nil), locations...),
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Locations[0] < conflicts[j].Locations[0]
+	})
+	return conflicts
+}
+
+// Fail with ErrDiskRegistered if VirtualBox has the image at the location
+// registered.
+func checkUnregistered(location string) error {
+	location, err := filepath.Abs(location)
+	if err != nil {
+		return err
+	}
+	bytes, err := vboxManage("list", "hdds")
+	if err != nil {
+		return err
+	}
+	disks, err := parseListedHardDisks(string(bytes))
+	if err != nil {
+		return err
+	}
+	for _, disk := range disks {
+		if disk.Location == location {
+			return ErrDiskRegistered
+		}
+	}
+	return nil
+}
+
+// Give the unregistered image at the location a new UUID so a copy of it
+// can be registered next to the original, and return the UUID. A random
+// UUID is used if none is given. Differencing images based on the image
+// need their parent UUID updated with SetParentUUID.
+func SetHardDiskUUID(location string, newUUID *uuid.UUID) (*uuid.UUID, error) {
+	err := checkUnregistered(location)
+	if err != nil {
+		return nil, err
+	}
+	if newUUID == nil {
+		newUUID, err = uuid.NewV4()
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = vboxManageModify("internalcommands", "sethduuid", location, newUUID.String())
+	if err != nil {
+		return nil, err
+	}
+	return newUUID, nil
+}
+
+// Point the unregistered differencing image at the location to the parent
+// with the given UUID, after the parent was given a new one.
+func SetParentUUID(location string, parent uuid.UUID) error {
+	err := checkUnregistered(location)
+	if err != nil {
+		return err
+	}
+	_, err = vboxManageModify("internalcommands", "setparentuuid", location, parent.String())
+	return err
+}
@@ -0,0 +1,167 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// A named instance of a compose manifest, isolated from the other instances
+// of the same manifest on the host so that several copies of an environment
+// can run side by side. Machine names and the internal and NAT network
+// names are prefixed with the instance name, the machines are grouped by
+// instance, and the forwarded host ports are moved by the port offset.
+// Host-only and bridged interfaces are shared between instances.
+type Environment struct {
+	Name       string
+	Manifest   *ComposeManifest
+	PortOffset int // added to every forwarded host port
+}
+
+// Get the name the machine of the manifest has in this instance.
+func (env *Environment) MachineName(name string) string {
+	return env.Name + "-" + name
+}
+
+// Get the manifest of this instance, with the machines, networks and ports
+// renamed and moved.
+func (env *Environment) Compose() (*ComposeManifest, error) {
+	if env.Name == "" {
+		return nil, errors.New("virtualbox: environment needs a name")
+	}
+	manifest := &ComposeManifest{
+		Name:     env.Name,
+		Networks: make(map[string]ComposeNetwork, len(env.Manifest.Networks)),
+		Machines: make([]ComposeMachine, 0, len(env.Manifest.Machines)),
+	}
+	if env.Manifest.Name != "" {
+		manifest.Name = env.Manifest.Name + "-" + env.Name
+	}
+	for name, network := range env.Manifest.Networks {
+		if network.Interface != "" && network.Mode != NetworkHostOnly && network.Mode != NetworkBridged {
+			network.Interface = env.Name + "-" + network.Interface
+		}
+		manifest.Networks[name] = network
+	}
+	for _, machine := range env.Manifest.Machines {
+		machine.Name = env.MachineName(machine.Name)
+		forwards := make([]PortForward, 0, len(machine.Forwards))
+		for _, forward := range machine.Forwards {
+			forward.HostPort += Port(env.PortOffset)
+			if forward.HostPort < 1 || forward.HostPort > 65535 {
+				return nil, fmt.Errorf("virtualbox: port offset %d moves forward %s of %s out of range",
+					env.PortOffset, forward.Name, machine.Name)
+			}
+			forwards = append(forwards, forward)
+		}
+		machine.Forwards = forwards
+		dependsOn := make([]string, 0, len(machine.DependsOn))
+		for _, name := range machine.DependsOn {
+			dependsOn = append(dependsOn, env.MachineName(name))
+		}
+		machine.DependsOn = dependsOn
+		manifest.Machines = append(manifest.Machines, machine)
+	}
+	return manifest, manifest.validate()
+}
+
+// Bring up this instance with ComposeUp.
+func (env *Environment) Up(ctx context.Context, opts ...StartGroupOption) error {
+	manifest, err := env.Compose()
+	if err != nil {
+		return err
+	}
+	return ComposeUp(ctx, manifest, opts...)
+}
+
+// Tear down this instance with ComposeDown, leaving the other instances
+// alone.
+func (env *Environment) Down(ctx context.Context) error {
+	manifest, err := env.Compose()
+	if err != nil {
+		return err
+	}
+	return ComposeDown(ctx, manifest)
+}
+
+// Load the machines of this instance, in manifest order.
+func (env *Environment) machines() ([]*Machine, error) {
+	machines := make([]*Machine, 0, len(env.Manifest.Machines))
+	for _, composed := range env.Manifest.Machines {
+		machine, err := LoadMachine(env.MachineName(composed.Name))
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+// Take a snapshot with the name of every machine of this instance. The
+// running machines are all paused before the first snapshot and resumed
+// after the last one, so the snapshots capture the same moment of the
+// environment.
+func (env *Environment) Checkpoint(name string) error {
+	machines, err := env.machines()
+	if err != nil {
+		return err
+	}
+	var paused []*Machine
+	resume := func() error {
+		var errs []error
+		for _, machine := range paused {
+			errs = append(errs, machine.Resume())
+		}
+		return errors.Join(errs...)
+	}
+	for _, machine := range machines {
+		if machine.Status != Running {
+			continue
+		}
+		err = machine.Pause()
+		if err != nil {
+			return errors.Join(err, resume())
+		}
+		paused = append(paused, machine)
+	}
+	for _, machine := range machines {
+		_, err = machine.TakeSnapshot(name, "")
+		if err != nil {
+			return errors.Join(fmt.Errorf("virtualbox: snapshot of %s: %w", machine.Name, err), resume())
+		}
+	}
+	return resume()
+}
+
+// Restore every machine of this instance to its snapshot taken by
+// Checkpoint with the name, powering off the running ones first. Nothing is
+// changed unless every machine has the snapshot. Machines checkpointed while
+// running are left saved; use Up to resume them in dependency order.
+func (env *Environment) Restore(name string) error {
+	machines, err := env.machines()
+	if err != nil {
+		return err
+	}
+	snapshots := make([]*Snapshot, len(machines))
+	for index, machine := range machines {
+		snapshots[index] = machine.snapshotNamed(name)
+		if snapshots[index] == nil {
+			return fmt.Errorf("virtualbox: machine %s has no snapshot %s", machine.Name, name)
+		}
+	}
+	for _, machine := range machines {
+		if machine.Status == Running || machine.Status == Paused || machine.Status == Stuck {
+			err = machine.PowerOff()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for index, machine := range machines {
+		err = machine.RestoreSnapshot(snapshots[index].UUID)
+		if err != nil {
+			return fmt.Errorf("virtualbox: restoring %s: %w", machine.Name, err)
+		}
+	}
+	return nil
+}
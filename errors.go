@@ -0,0 +1,100 @@
+package virtualbox
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Returned when a disk image is in use by another machine or a running
+	// medium operation.
+	ErrMediumLocked = errors.New("virtualbox: medium is locked")
+
+	// Returned when another session, such as a running machine or a
+	// concurrent VBoxManage, holds the lock on the machine settings.
+	ErrSessionBusy = errors.New("virtualbox: machine is locked by another session")
+)
+
+// A VBoxManage command that exited with an error. It matches
+// ErrMachineNotFound, ErrMediumLocked or ErrSessionBusy with errors.Is when
+// the output names one of these reasons, and the *exec.ExitError with
+// errors.As.
+type CommandError struct {
+	Args    []string
+	Code    string // the result code, such as VBOX_E_OBJECT_NOT_FOUND, if reported
+	Message string // the first error line
+	Stderr  []byte
+	Err     *exec.ExitError
+
+	reason error
+}
+
+func (e *CommandError) Error() string {
+	command := "VBoxManage"
+	if len(e.Args) != 0 {
+		command += " " + e.Args[0]
+	}
+	if e.Message != "" {
+		return "virtualbox: " + command + " failed: " + e.Message
+	}
+	return "virtualbox: " + command + " failed: " + e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() []error {
+	if e.reason != nil {
+		return []error{e.reason, e.Err}
+	}
+	return []error{e.Err}
+}
+
+var (
+	commandErrorLine = regexp.MustCompile(`(?m)^VBoxManage(?:\.exe)?: error: (.*)$`)
+	commandErrorCode = regexp.MustCompile(`code (VBOX_E_\w+|NS_ERROR_\w+|E_\w+)`)
+)
+
+// The messages VirtualBox uses for the failures callers branch on.
+var commandErrorReasons = []struct {
+	message string
+	reason  error
+}{
+	{"Could not find a registered machine", ErrMachineNotFound},
+	{"is already locked by a session", ErrSessionBusy},
+	{"is already locked for a session", ErrSessionBusy},
+	{"is locked for reading", ErrMediumLocked},
+	{"is locked for writing", ErrMediumLocked},
+}
+
+// Wrap a failure of VBoxManage in a CommandError describing it from the
+// standard error. Other errors, such as VBoxManage not being installed,
+// are returned as they are.
+func commandError(args []string, stderr []byte, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if stderr == nil {
+		stderr = exitErr.Stderr
+	}
+	commandErr := &CommandError{
+		Args:   args,
+		Stderr: stderr,
+		Err:    exitErr,
+	}
+	for _, match := range commandErrorLine.FindAllSubmatch(stderr, -1) {
+		line := strings.TrimSpace(string(match[1]))
+		if commandErr.Message == "" && !strings.HasPrefix(line, "Details:") {
+			commandErr.Message = line
+		}
+		if code := commandErrorCode.FindStringSubmatch(line); code != nil && commandErr.Code == "" {
+			commandErr.Code = code[1]
+		}
+		for _, known := range commandErrorReasons {
+			if commandErr.reason == nil && strings.Contains(line, known.message) {
+				commandErr.reason = known.reason
+			}
+		}
+	}
+	return commandErr
+}
@@ -0,0 +1,58 @@
+package virtualbox
+
+import (
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Lifecycle operations reported as events.
+const (
+	OperationStart           = "start"
+	OperationPowerOff        = "poweroff"
+	OperationTakeSnapshot    = "snapshot-take"
+	OperationRestoreSnapshot = "snapshot-restore"
+	OperationDeleteSnapshot  = "snapshot-delete"
+)
+
+// The outcome of a lifecycle operation on a machine.
+type Event struct {
+	Operation   string
+	Machine     uuid.UUID
+	MachineName string
+	Started     time.Time
+	Duration    time.Duration
+	Err         error
+}
+
+// Receives an event after every lifecycle operation, whether it succeeded
+// or not. Events are delivered synchronously from the goroutine running the
+// operation, so sinks feeding slow consumers should queue them.
+type EventSink interface {
+	Event(event Event)
+}
+
+// Adapts a function into an EventSink.
+type EventSinkFunc func(event Event)
+
+func (f EventSinkFunc) Event(event Event) {
+	f(event)
+}
+
+// The sink receiving lifecycle events, nil to disable them.
+var Events EventSink
+
+// Report the operation on the machine that began at started.
+func (machine *Machine) emit(operation string, started time.Time, err error) {
+	if Events == nil {
+		return
+	}
+	Events.Event(Event{
+		Operation:   operation,
+		Machine:     machine.UUID,
+		MachineName: machine.Name,
+		Started:     started,
+		Duration:    time.Since(started),
+		Err:         err,
+	})
+}
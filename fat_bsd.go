@@ -0,0 +1,27 @@
+//go:build darwin || freebsd
+
+package virtualbox
+
+import "syscall"
+
+// Check if the file is stored on a FAT volume. exFAT has no 4GB file limit
+// and is not included.
+func onFATFilesystem(path string) (bool, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return false, err
+	}
+	var name []byte
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	switch string(name) {
+	case "msdos", "msdosfs":
+		return true, nil
+	}
+	return false, nil
+}
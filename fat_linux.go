@@ -0,0 +1,17 @@
+package virtualbox
+
+import "syscall"
+
+// Filesystem magic number of FAT from statfs(2).
+const msdosSuperMagic = 0x4d44
+
+// Check if the file is stored on a FAT volume. exFAT has no 4GB file limit
+// and is not included.
+func onFATFilesystem(path string) (bool, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return false, err
+	}
+	return stat.Type == msdosSuperMagic, nil
+}
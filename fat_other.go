@@ -0,0 +1,10 @@
+//go:build !darwin && !freebsd && !linux
+
+package virtualbox
+
+import "errors"
+
+// Filesystem detection is not implemented on this platform.
+func onFATFilesystem(path string) (bool, error) {
+	return false, errors.New("virtualbox: filesystem detection not supported on this platform")
+}
@@ -0,0 +1,173 @@
+package virtualbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type FirewallFormat string
+
+const (
+	FirewallPF       = FirewallFormat("pf")
+	FirewallIPTables = FirewallFormat("iptables") // ip6tables for IPv6 sources
+	FirewallNetsh    = FirewallFormat("netsh")
+)
+
+// Restricts a host port used by machines to the allowed sources.
+type FirewallRule struct {
+	Port     Port
+	Protocol Protocol
+	Allow    []string // CIDRs, such as 10.0.0.0/8
+	Comment  string   // the machines and purposes using the port
+}
+
+// Applies firewall rules, for example by running the commands of a format
+// or calling the API of a host firewall.
+type Firewall interface {
+	ApplyFirewallRules(ctx context.Context, rules []FirewallRule) error
+}
+
+// Get rules restricting the VRDE and forwarded ports of the PortMap to the
+// allowed CIDRs, one per port and protocol, ordered by port. Ports bound to
+// a loopback address are not reachable from other hosts and are skipped.
+func (vbox *VirtualBox) FirewallRules(allowed []string) ([]FirewallRule, error) {
+	for _, cidr := range allowed {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("virtualbox: invalid CIDR %q", cidr)
+		}
+	}
+	vbox.mutex.RLock()
+	ports := vbox.PortMap()
+	vbox.mutex.RUnlock()
+
+	type key struct {
+		port     Port
+		protocol Protocol
+	}
+	users := make(map[key][]string)
+	for port, uses := range ports {
+		for _, use := range uses {
+			if ip := net.ParseIP(use.HostIP); ip != nil && ip.IsLoopback() {
+				continue
+			}
+			protocol := use.Protocol
+			if protocol == "" {
+				protocol = TCP
+			}
+			user := use.MachineName + " " + use.Purpose
+			if use.Name != "" {
+				user += " " + use.Name
+			}
+			users[key{port, protocol}] = append(users[key{port, protocol}], user)
+		}
+	}
+
+	rules := make([]FirewallRule, 0, len(users))
+	for key, names := range users {
+		sort.Strings(names)
+		rules = append(rules, FirewallRule{
+			Port:     key.port,
+			Protocol: key.protocol,
+			Allow:    append([]string(nil), allowed...),
+			Comment:  strings.Join(names, ", "),
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Port != rules[j].Port {
+			return rules[i].Port < rules[j].Port
+		}
+		return rules[i].Protocol < rules[j].Protocol
+	})
+	return rules, nil
+}
+
+// Characters replaced in comments, which come from machine names and must
+// not be interpreted by the shell.
+var firewallCommentUnsafe = regexp.MustCompile(`[^A-Za-z0-9 ._,:/@+-]`)
+
+// The longest comment iptables accepts.
+const firewallCommentMax = 255
+
+// Get the comment of the rule safe to use in the commands of all formats.
+func (rule *FirewallRule) safeComment() string {
+	comment := firewallCommentUnsafe.ReplaceAllString(rule.Comment, "_")
+	if len(comment) > firewallCommentMax {
+		comment = comment[:firewallCommentMax-3] + "..."
+	}
+	return comment
+}
+
+// Format the rule as commands or configuration lines in the format.
+// Sources are allowed and everyone else is blocked, except for netsh where
+// Windows already blocks inbound connections without an allowing rule.
+func (rule *FirewallRule) lines(format FirewallFormat) ([]string, error) {
+	port := rule.Port.String()
+	comment := rule.safeComment()
+	switch format {
+	case FirewallPF:
+		lines := []string{"# " + comment}
+		if len(rule.Allow) != 0 {
+			lines = append(lines, fmt.Sprintf("pass in quick proto %s from { %s } to any port %s",
+				rule.Protocol, strings.Join(rule.Allow, " "), port))
+		}
+		return append(lines, fmt.Sprintf("block in quick proto %s to any port %s",
+			rule.Protocol, port)), nil
+	case FirewallIPTables:
+		var lines []string
+		comment := "-m comment --comment '" + comment + "'"
+		for _, cidr := range rule.Allow {
+			command := "iptables"
+			if ip, _, _ := net.ParseCIDR(cidr); ip != nil && ip.To4() == nil {
+				command = "ip6tables"
+			}
+			lines = append(lines, fmt.Sprintf("%s -A INPUT -p %s --dport %s -s %s %s -j ACCEPT",
+				command, rule.Protocol, port, cidr, comment))
+		}
+		for _, command := range []string{"iptables", "ip6tables"} {
+			lines = append(lines, fmt.Sprintf("%s -A INPUT -p %s --dport %s %s -j DROP",
+				command, rule.Protocol, port, comment))
+		}
+		return lines, nil
+	case FirewallNetsh:
+		remote := "any"
+		if len(rule.Allow) != 0 {
+			remote = strings.Join(rule.Allow, ",")
+		}
+		return []string{fmt.Sprintf(
+			`netsh advfirewall firewall add rule name="VirtualBox %s" dir=in action=allow protocol=%s localport=%s remoteip=%s`,
+			comment, strings.ToUpper(string(rule.Protocol)), port, remote)}, nil
+	}
+	return nil, fmt.Errorf("virtualbox: unknown firewall format %q", format)
+}
+
+// Write the rules in the format, as suggestions to review before applying
+// them to the host firewall.
+func WriteFirewallRules(w io.Writer, format FirewallFormat, rules []FirewallRule) error {
+	var output strings.Builder
+	for _, rule := range rules {
+		lines, err := rule.lines(format)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			output.WriteString(line + "\n")
+		}
+	}
+	_, err := io.WriteString(w, output.String())
+	return err
+}
+
+// Apply rules restricting the ports of the machines to the allowed CIDRs
+// through the firewall.
+func (vbox *VirtualBox) ApplyFirewall(ctx context.Context, firewall Firewall, allowed []string) error {
+	rules, err := vbox.FirewallRules(allowed)
+	if err != nil {
+		return err
+	}
+	return firewall.ApplyFirewallRules(ctx, rules)
+}
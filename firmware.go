@@ -0,0 +1,193 @@
+package virtualbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+type Firmware string
+
+const (
+	BIOS  = Firmware("bios")
+	EFI   = Firmware("efi")
+	EFI32 = Firmware("efi32")
+	EFI64 = Firmware("efi64")
+)
+
+type TPMType string
+
+const (
+	TPMNone     = TPMType("none")
+	TPMv1_2     = TPMType("1.2")
+	TPMv2_0     = TPMType("2.0")
+	TPMHost     = TPMType("host")
+	TPMSoftware = TPMType("swtpm")
+)
+
+// Convert the Firmware type attribute from the machine XML.
+func parseFirmware(xmlType string) Firmware {
+	if xmlType == "" {
+		return BIOS
+	}
+	return Firmware(strings.ToLower(xmlType))
+}
+
+// Convert the TrustedPlatformModule type attribute from the machine XML,
+// which uses names such as "v2_0", into the modifyvm form.
+func parseTPMType(xmlType string) TPMType {
+	switch xmlType {
+	case "", "None":
+		return TPMNone
+	case "v1_2":
+		return TPMv1_2
+	case "v2_0":
+		return TPMv2_0
+	case "Host":
+		return TPMHost
+	case "Swtpm":
+		return TPMSoftware
+	}
+	return TPMType(strings.ToLower(xmlType))
+}
+
+// Set the firmware used by the machine.
+func (machine *Machine) SetFirmware(firmware Firmware) error {
+	err := machine.modifyVM("--firmware", string(firmware))
+	if err != nil {
+		return err
+	}
+	machine.Firmware = firmware
+	return nil
+}
+
+// Set the TPM type of the machine. Requires VirtualBox 7.
+func (machine *Machine) SetTPMType(tpm TPMType) error {
+	err := machine.modifyVM("--tpm-type", string(tpm))
+	if err != nil {
+		return err
+	}
+	machine.TPM = tpm
+	return nil
+}
+
+// Set the UUID the firmware reports to the guest, which defaults to the
+// machine UUID. Software licensed to a machine checks this one, so clones
+// can keep running it by setting the original UUID.
+func (machine *Machine) SetHardwareUUID(hardwareUUID uuid.UUID) error {
+	err := machine.modifyVM("--hardwareuuid", hardwareUUID.String())
+	if err != nil {
+		return err
+	}
+	machine.HardwareUUID = &hardwareUUID
+	return nil
+}
+
+// Offset the guest clock from the host clock, for example to test how
+// software handles expired certificates. The guest should not synchronize
+// its clock with the host, see SetHostTimeSyncDisabled.
+func (machine *Machine) SetBIOSTimeOffset(offset time.Duration) error {
+	err := machine.modifyVM("--biossystemtimeoffset",
+		strconv.FormatInt(int64(offset/time.Millisecond), 10))
+	if err != nil {
+		return err
+	}
+	machine.BIOSTimeOffset = offset
+	return nil
+}
+
+// Minimum requirements for Windows 11.
+const (
+	Windows11MinCPUs   = 2
+	Windows11MinMemory = 4096
+)
+
+type ReadinessCheck struct {
+	Name   string
+	Passed bool
+	Detail string
+	Fix    [][]string `json:",omitempty"` // VBoxManage invocations that resolve it
+}
+
+type Readiness struct {
+	Checks []ReadinessCheck
+}
+
+// Check if all the checks passed.
+func (readiness *Readiness) Ready() bool {
+	for _, check := range readiness.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the VBoxManage invocations needed to address all failing checks.
+func (readiness *Readiness) Fixes() (fixes [][]string) {
+	for _, check := range readiness.Checks {
+		if !check.Passed {
+			fixes = append(fixes, check.Fix...)
+		}
+	}
+	return
+}
+
+// Check the machine against the Windows 11 hardware requirements: TPM 2.0,
+// EFI with secure boot, at least 2 CPUs and 4GB of memory. Secure boot state
+// lives in the NVRAM store so it is queried through showvminfo.
+func (machine *Machine) Windows11Readiness() (*Readiness, error) {
+	id := machine.UUID.String()
+	info, err := showVMInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	efi := strings.HasPrefix(string(machine.Firmware), "efi")
+	secureBoot := info["SecureBoot"] == "on"
+
+	readiness := &Readiness{Checks: []ReadinessCheck{
+		{
+			Name:   "TPM",
+			Passed: machine.TPM == TPMv2_0 || machine.TPM == TPMHost,
+			Detail: fmt.Sprintf("TPM type is %s, 2.0 required", machine.TPM),
+			Fix:    [][]string{{"modifyvm", id, "--tpm-type", string(TPMv2_0)}},
+		},
+		{
+			Name:   "EFI",
+			Passed: efi,
+			Detail: fmt.Sprintf("firmware is %s, EFI required", machine.Firmware),
+			Fix:    [][]string{{"modifyvm", id, "--firmware", string(EFI)}},
+		},
+		{
+			Name:   "SecureBoot",
+			Passed: efi && secureBoot,
+			Detail: "secure boot must be enabled",
+			Fix: [][]string{
+				{"modifynvram", id, "inituefivarstore"},
+				{"modifynvram", id, "enrollmssignatures"},
+				{"modifynvram", id, "enrollorclpk"},
+				{"modifynvram", id, "secureboot", "--enable"},
+			},
+		},
+		{
+			Name:   "CPUs",
+			Passed: machine.CPUs >= Windows11MinCPUs,
+			Detail: fmt.Sprintf("%d CPUs, %d required", machine.CPUs, Windows11MinCPUs),
+			Fix: [][]string{
+				{"modifyvm", id, "--cpus", strconv.Itoa(Windows11MinCPUs)},
+			},
+		},
+		{
+			Name:   "Memory",
+			Passed: machine.Memory >= Windows11MinMemory,
+			Detail: fmt.Sprintf("%dMB memory, %dMB required", machine.Memory, Windows11MinMemory),
+			Fix: [][]string{
+				{"modifyvm", id, "--memory", strconv.Itoa(Windows11MinMemory)},
+			},
+		},
+	}}
+	return readiness, nil
+}
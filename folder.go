@@ -0,0 +1,29 @@
+package virtualbox
+
+import (
+	"path/filepath"
+)
+
+// Get the folder holding the machine settings file.
+func (machine *Machine) Folder() string {
+	return filepath.Dir(machine.Source)
+}
+
+// Get the folder holding the machine's snapshot differencing disks and
+// saved states, which is "Snapshots" in the machine folder unless the
+// settings say otherwise.
+func (machine *Machine) SnapshotsFolder() string {
+	folder := machine.snapshotFolder
+	if folder == "" {
+		folder = "Snapshots"
+	}
+	if filepath.IsAbs(folder) {
+		return folder
+	}
+	return filepath.Join(machine.Folder(), folder)
+}
+
+// Get the folder holding the VBox.log files of the machine.
+func (machine *Machine) LogsFolder() string {
+	return filepath.Join(machine.Folder(), "Logs")
+}
@@ -0,0 +1,182 @@
+package virtualbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// A point in time measurement of the space used by all disks of a machine,
+// including the differencing disks created by snapshots.
+type DiskSample struct {
+	Time    time.Time
+	Machine string
+	Bytes   int64
+}
+
+// An append only journal of DiskSample values, persisted as one JSON object
+// per line so that samples can be collected over days by periodic runs.
+type DiskJournal struct {
+	Path    string
+	Samples []DiskSample
+}
+
+type DiskForecast struct {
+	Machine        uuid.UUID
+	CurrentBytes   int64
+	BytesPerDay    float64
+	ProjectedBytes int64      // usage after the forecast period
+	HostFreeBytes  int64      // free space on the volume holding the disks
+	FullAt         *time.Time `json:",omitempty"` // nil if not full within 100 years
+}
+
+// How far ahead FullAt is projected.
+const forecastHorizonDays = 100 * 365
+
+var ErrNotEnoughSamples = errors.New("virtualbox: at least 2 disk samples are required")
+
+// Open the journal at the given path, loading existing samples. A missing
+// file results in an empty journal.
+func OpenDiskJournal(journalPath string) (*DiskJournal, error) {
+	journal := &DiskJournal{Path: journalPath}
+	file, err := os.Open(journalPath)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample DiskSample
+		err = json.Unmarshal(scanner.Bytes(), &sample)
+		if err != nil {
+			return nil, err
+		}
+		journal.Samples = append(journal.Samples, sample)
+	}
+	return journal, scanner.Err()
+}
+
+// Get all the disks in the differencing trees containing the disks attached
+// to the machine.
+func (vbox *VirtualBox) machineDiskTree(machine *Machine) []*HardDisk {
+	seen := make(map[uuid.UUID]bool)
+	var disks []*HardDisk
+	var walk func(disk *HardDisk)
+	walk = func(disk *HardDisk) {
+		if seen[disk.UUID] {
+			return
+		}
+		seen[disk.UUID] = true
+		disks = append(disks, disk)
+		for _, child := range disk.Children {
+			if childDisk := vbox.HardDisks[*child]; childDisk != nil {
+				walk(childDisk)
+			}
+		}
+	}
+	for _, attached := range machine.HardDisks {
+		disk := vbox.HardDisks[*attached]
+		for disk != nil && disk.Parent != nil && vbox.HardDisks[*disk.Parent] != nil {
+			disk = vbox.HardDisks[*disk.Parent]
+		}
+		if disk != nil {
+			walk(disk)
+		}
+	}
+	return disks
+}
+
+// Measure the actual size of the machine's disks and append the sample to
+// the journal.
+func (journal *DiskJournal) Record(vbox *VirtualBox, machine *Machine) (*DiskSample, error) {
+	sample := DiskSample{Time: time.Now(), Machine: machine.UUID.String()}
+	for _, disk := range vbox.machineDiskTree(machine) {
+		info, err := os.Stat(disk.Location)
+		if err != nil {
+			return nil, err
+		}
+		sample.Bytes += info.Size()
+	}
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(
+		journal.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return nil, err
+	}
+	journal.Samples = append(journal.Samples, sample)
+	return &sample, nil
+}
+
+// Project the machine's disk usage the given number of days ahead using a
+// least squares fit over the journaled samples, and estimate when the host
+// volume holding the disks will fill up.
+func (journal *DiskJournal) ForecastDiskGrowth(vbox *VirtualBox, machine *Machine, days int) (*DiskForecast, error) {
+	var samples []DiskSample
+	for _, sample := range journal.Samples {
+		if sample.Machine == machine.UUID.String() {
+			samples = append(samples, sample)
+		}
+	}
+	if len(samples) < 2 {
+		return nil, ErrNotEnoughSamples
+	}
+
+	origin := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.Time.Sub(origin).Hours() / 24
+		y := float64(sample.Bytes)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	slope := 0.0
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		slope = (n*sumXY - sumX*sumY) / denominator
+	}
+
+	last := samples[len(samples)-1]
+	forecast := &DiskForecast{
+		Machine:        machine.UUID,
+		CurrentBytes:   last.Bytes,
+		BytesPerDay:    slope,
+		ProjectedBytes: last.Bytes + int64(slope*float64(days)),
+	}
+
+	dir := filepath.Dir(machine.Source)
+	if disks := vbox.machineDiskTree(machine); len(disks) != 0 {
+		dir = filepath.Dir(disks[0].Location)
+	}
+	free, err := freeBytes(dir)
+	if err != nil {
+		return nil, err
+	}
+	forecast.HostFreeBytes = free
+	// the free space is measured now, not when the last sample was taken,
+	// and beyond the horizon the date would overflow a time.Duration
+	if daysLeft := float64(free) / slope; slope > 0 && daysLeft <= forecastHorizonDays {
+		fullAt := time.Now().Add(time.Duration(daysLeft * 24 * float64(time.Hour)))
+		forecast.FullAt = &fullAt
+	}
+	return forecast, nil
+}
@@ -0,0 +1,155 @@
+package virtualbox
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Address used to reach rules listening on all interfaces.
+const loopbackAddress = "127.0.0.1"
+
+type Protocol string
+
+const (
+	TCP = Protocol("tcp")
+	UDP = Protocol("udp")
+)
+
+// A NAT port forwarding rule from the host to the guest.
+type PortForward struct {
+	Name      string
+	Protocol  Protocol
+	HostIP    string `json:",omitempty"` // empty to listen on all interfaces
+	HostPort  Port
+	GuestIP   string `json:",omitempty"` // empty for the guest's DHCP address
+	GuestPort Port
+}
+
+// The proto attribute of the XML stores the protocol as a number.
+func (forwarding *xmlNetworkForwarding) forward() PortForward {
+	protocol := TCP
+	if forwarding.Protocol == 0 {
+		protocol = UDP
+	}
+	return PortForward{
+		Name:      forwarding.Name,
+		Protocol:  protocol,
+		HostIP:    forwarding.HostIP,
+		HostPort:  forwarding.HostPort,
+		GuestIP:   forwarding.GuestIP,
+		GuestPort: forwarding.GuestPort,
+	}
+}
+
+// Format the rule the way --natpf expects it.
+func (forward *PortForward) rule() string {
+	protocol := forward.Protocol
+	if protocol == "" {
+		protocol = TCP
+	}
+	return strings.Join([]string{
+		forward.Name, string(protocol), forward.HostIP, forward.HostPort.String(),
+		forward.GuestIP, forward.GuestPort.String(),
+	}, ",")
+}
+
+// Check the rule can be given to VirtualBox.
+func (forward *PortForward) validate() error {
+	if forward.Name == "" || strings.ContainsAny(forward.Name, ",") {
+		return fmt.Errorf("virtualbox: invalid forwarding rule name %q", forward.Name)
+	}
+	for _, ip := range []string{forward.HostIP, forward.GuestIP} {
+		if ip != "" && net.ParseIP(ip) == nil {
+			return fmt.Errorf("virtualbox: invalid forwarding address %q", ip)
+		}
+	}
+	err := forward.HostPort.validateHost()
+	if err != nil {
+		return err
+	}
+	return forward.GuestPort.Validate()
+}
+
+// Get the port forwarding rules of all network adapters.
+func (machine *Machine) PortForwards() []PortForward {
+	return append([]PortForward(nil), machine.Forwards...)
+}
+
+// Change the rules of the first network adapter, with controlvm for running
+// machines so the change applies immediately.
+func (machine *Machine) natpf(args ...string) error {
+	if machine.Status == Running || machine.Status == Paused {
+		return machine.controlVM(append([]string{"natpf1"}, args...)...)
+	}
+	return machine.modifyVM(append([]string{"--natpf1"}, args...)...)
+}
+
+// Add a port forwarding rule to the first NAT network adapter. Set HostIP
+// to a loopback address to keep the forwarded service off other interfaces.
+func (machine *Machine) AddPortForward(forward PortForward) error {
+	err := forward.validate()
+	if err != nil {
+		return err
+	}
+	err = machine.natpf(forward.rule())
+	if err != nil {
+		return err
+	}
+	if forward.Protocol == "" {
+		forward.Protocol = TCP
+	}
+	machine.Forwards = append(machine.Forwards, forward)
+	if adapter := machine.NetworkAdapter(1); adapter != nil {
+		adapter.Forwards = append(adapter.Forwards, forward)
+	}
+	if forward.Name == "selenium" {
+		machine.SeleniumPort = forward.HostPort
+	}
+	return nil
+}
+
+// Remove the port forwarding rule with the name from the first NAT network
+// adapter.
+func (machine *Machine) RemovePortForward(name string) error {
+	err := machine.natpf("delete", name)
+	if err != nil {
+		return err
+	}
+	machine.Forwards = withoutForward(machine.Forwards, name)
+	if adapter := machine.NetworkAdapter(1); adapter != nil {
+		adapter.Forwards = withoutForward(adapter.Forwards, name)
+	}
+	if name == "selenium" {
+		machine.SeleniumPort = 0
+	}
+	return nil
+}
+
+func withoutForward(forwards []PortForward, name string) []PortForward {
+	var kept []PortForward
+	for _, forward := range forwards {
+		if forward.Name != name {
+			kept = append(kept, forward)
+		}
+	}
+	return kept
+}
+
+// Get the host address other programs on the host connect to for the rule,
+// which is the bind address or the loopback address for rules listening on
+// all interfaces. IPv6 addresses are enclosed in brackets.
+func (forward *PortForward) HostAddress() string {
+	return hostAddress(forward.HostIP, forward.HostPort)
+}
+
+// Get the address to connect to for a service bound to the host and port.
+func hostAddress(host string, port Port) string {
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = loopbackAddress
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, port.String())
+}
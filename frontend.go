@@ -0,0 +1,40 @@
+package virtualbox
+
+import (
+	"strings"
+)
+
+// Set the frontend the machine starts with when no type is given, or
+// DefaultFrontend to use the global default.
+func (machine *Machine) SetDefaultFrontend(frontend Frontend) error {
+	err := machine.modifyVM("--defaultfrontend", string(frontend))
+	if err != nil {
+		return err
+	}
+	machine.Frontend = frontend
+	if frontend == DefaultFrontend {
+		machine.Frontend = ""
+	}
+	return nil
+}
+
+// Get the frontend of the running machine from its session name, or an
+// empty Frontend if it is not running. Machines started with Separate run a
+// headless session with a GUI attached, and report as GUI only while that
+// GUI is attached.
+func (machine *Machine) RunningFrontend() (Frontend, error) {
+	info, err := showVMInfo(machine.UUID.String())
+	if err != nil {
+		return "", err
+	}
+	session := info["SessionName"]
+	switch {
+	case session == "":
+		return "", nil
+	case strings.EqualFold(session, "headless"):
+		return Headless, nil
+	case strings.HasPrefix(strings.ToUpper(session), "GUI"):
+		return GUI, nil
+	}
+	return Frontend(strings.ToLower(session)), nil
+}
@@ -0,0 +1,157 @@
+package virtualbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type GraphFormat string
+
+const (
+	GraphDOT  = GraphFormat("dot")
+	GraphJSON = GraphFormat("json")
+)
+
+type graphNode struct {
+	ID    string
+	Kind  string // machine, disk, network or forward
+	Label string
+}
+
+type graphEdge struct {
+	From  string
+	To    string
+	Label string `json:",omitempty"`
+}
+
+type graph struct {
+	Nodes []graphNode
+	Edges []graphEdge
+
+	seen map[string]bool
+}
+
+func (graph *graph) node(id, kind, label string) {
+	if graph.seen[id] {
+		return
+	}
+	graph.seen[id] = true
+	graph.Nodes = append(graph.Nodes, graphNode{ID: id, Kind: kind, Label: label})
+}
+
+func (graph *graph) edge(from, to, label string) {
+	graph.Edges = append(graph.Edges, graphEdge{From: from, To: to, Label: label})
+}
+
+// Get the node for the network the adapter is attached to. NAT networks are
+// private to each adapter.
+func (adapter *NetworkAdapter) graphNode(machine *Machine) (id, label string) {
+	switch adapter.Mode {
+	case NetworkNAT:
+		return fmt.Sprintf("network:nat:%s:%d", machine.UUID.String(), adapter.Slot), "NAT"
+	case NetworkNATNetwork:
+		return "network:natnetwork:" + adapter.NATNetwork, "NAT network " + adapter.NATNetwork
+	case NetworkBridged:
+		return "network:bridged:" + adapter.BridgedInterface, "bridged " + adapter.BridgedInterface
+	case NetworkInternal:
+		return "network:intnet:" + adapter.InternalNetwork, "internal " + adapter.InternalNetwork
+	case NetworkHostOnly:
+		return "network:hostonly:" + adapter.HostOnlyInterface, "host-only " + adapter.HostOnlyInterface
+	case NetworkGeneric:
+		return "network:generic:" + adapter.GenericDriver, "generic " + adapter.GenericDriver
+	}
+	return "", ""
+}
+
+// Collect the machines, their disk chains, the networks their adapters are
+// attached to and the forwarding rules into those networks.
+func (vbox *VirtualBox) graph() *graph {
+	graph := &graph{seen: make(map[string]bool)}
+	machines := make([]*Machine, 0, len(vbox.Machines))
+	for _, machine := range vbox.Machines {
+		machines = append(machines, machine)
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+
+	for _, machine := range machines {
+		machineID := "machine:" + machine.UUID.String()
+		label := machine.Name
+		if machine.Status != "" {
+			label += " (" + string(machine.Status) + ")"
+		}
+		graph.node(machineID, "machine", label)
+
+		for _, disk := range vbox.machineDiskTree(machine) {
+			graph.node("disk:"+disk.UUID.String(), "disk", filepath.Base(disk.Location))
+			if disk.Parent != nil && vbox.HardDisks[*disk.Parent] != nil {
+				graph.edge("disk:"+disk.Parent.String(), "disk:"+disk.UUID.String(), "")
+			}
+		}
+		for _, controller := range machine.StorageControllers {
+			for _, device := range controller.Devices {
+				if device.Medium != nil && vbox.HardDisks[*device.Medium] != nil {
+					graph.edge(machineID, "disk:"+device.Medium.String(),
+						fmt.Sprintf("%s %d:%d", controller.Name, device.Port, device.Device))
+				}
+			}
+		}
+
+		for _, adapter := range machine.NetworkAdapters {
+			networkID, networkLabel := adapter.graphNode(machine)
+			if !adapter.Enabled || networkID == "" {
+				continue
+			}
+			graph.node(networkID, "network", networkLabel)
+			graph.edge(machineID, networkID, "nic"+strconv.Itoa(adapter.Slot))
+			for _, forward := range adapter.Forwards {
+				forwardID := fmt.Sprintf("forward:%s/%s", forward.Protocol, forward.HostAddress())
+				graph.node(forwardID, "forward", fmt.Sprintf("%s %s", forward.Protocol, forward.HostAddress()))
+				guest := net.JoinHostPort(forward.GuestIP, forward.GuestPort.String())
+				graph.edge(forwardID, networkID, forward.Name+" to "+strings.TrimPrefix(guest, ":"))
+			}
+		}
+	}
+	return graph
+}
+
+// Render the machines, disks, networks and forwarding rules as a graph in
+// the given format, for documentation and debugging of lab setups.
+func (vbox *VirtualBox) WriteGraph(w io.Writer, format GraphFormat) error {
+	vbox.mutex.RLock()
+	graph := vbox.graph()
+	vbox.mutex.RUnlock()
+
+	switch format {
+	case GraphJSON:
+		return json.NewEncoder(w).Encode(graph)
+	case GraphDOT:
+		var dot strings.Builder
+		dot.WriteString("digraph virtualbox {\n")
+		shapes := map[string]string{
+			"machine": "box", "disk": "cylinder", "network": "ellipse", "forward": "plaintext",
+		}
+		for _, node := range graph.Nodes {
+			fmt.Fprintf(&dot, "\t%s [label=%s shape=%s];\n",
+				dotQuote(node.ID), dotQuote(node.Label), shapes[node.Kind])
+		}
+		for _, edge := range graph.Edges {
+			fmt.Fprintf(&dot, "\t%s -> %s", dotQuote(edge.From), dotQuote(edge.To))
+			if edge.Label != "" {
+				fmt.Fprintf(&dot, " [label=%s]", dotQuote(edge.Label))
+			}
+			dot.WriteString(";\n")
+		}
+		dot.WriteString("}\n")
+		_, err := io.WriteString(w, dot.String())
+		return err
+	}
+	return fmt.Errorf("virtualbox: unknown graph format %q", format)
+}
@@ -0,0 +1,187 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Credentials of a guest account used by guest control operations.
+type GuestCredentials struct {
+	Username string
+	Password string
+	Domain   string `json:",omitempty"`
+}
+
+// Get the arguments logging in with the credentials, and the function
+// removing the file the password is passed in, which keeps it out of the
+// process list.
+func (creds GuestCredentials) args() (args []string, remove func(), err error) {
+	args = []string{"--username", creds.Username}
+	remove = func() {}
+	if creds.Password != "" {
+		var name string
+		name, remove, err = commandTempFile("password-*")
+		if err != nil {
+			return nil, nil, err
+		}
+		err = os.WriteFile(name, []byte(creds.Password), 0600)
+		if err != nil {
+			remove()
+			return nil, nil, err
+		}
+		args = append(args, "--passwordfile", name)
+	}
+	if creds.Domain != "" {
+		args = append(args, "--domain", creds.Domain)
+	}
+	return args, remove, nil
+}
+
+// Run the guestcontrol subcommand as the user, after any other command
+// changing the machine has finished, returning the outputs of VBoxManage.
+func (machine *Machine) guestControl(ctx context.Context, creds GuestCredentials, subcommand string, args ...string) (stdout, stderr []byte, err error) {
+	if ReadOnly {
+		return nil, nil, ErrReadOnly
+	}
+	err = machine.checkNamespace()
+	if err != nil {
+		return nil, nil, err
+	}
+	unlock, err := lockMachine(ctx, machine.UUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	credsArgs, remove, err := creds.args()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer remove()
+	command := append([]string{"guestcontrol", machine.UUID.String(), subcommand}, credsArgs...)
+	return vboxManageOutputs(ctx, append(command, args...)...)
+}
+
+// Run a program inside the guest and return its standard output.
+func (machine *Machine) guestRun(ctx context.Context, creds GuestCredentials, exe string, args ...string) ([]byte, error) {
+	stdout, _, err := machine.guestControl(ctx, creds, "run",
+		append([]string{"--exe", exe, "--", exe}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return stdout, nil
+}
+
+// The outcome of a program run inside the guest.
+type GuestExecResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int // of VBoxManage, which is the one of the program once it ran
+}
+
+// Changes how GuestExec runs the program.
+type GuestExecOption func(*guestExecOptions)
+
+type guestExecOptions struct {
+	domain     string
+	env        []string
+	workingDir string
+	timeout    time.Duration
+}
+
+// Log in to the guest account in the domain.
+func WithGuestDomain(domain string) GuestExecOption {
+	return func(options *guestExecOptions) {
+		options.domain = domain
+	}
+}
+
+// Set an environment variable for the program.
+func WithGuestEnv(name, value string) GuestExecOption {
+	return func(options *guestExecOptions) {
+		options.env = append(options.env, name+"="+value)
+	}
+}
+
+// Run the program in the guest directory. Requires VirtualBox 7.
+func WithGuestWorkingDir(dir string) GuestExecOption {
+	return func(options *guestExecOptions) {
+		options.workingDir = dir
+	}
+}
+
+// Have the Guest Additions kill the program if it runs longer.
+func WithGuestTimeout(timeout time.Duration) GuestExecOption {
+	return func(options *guestExecOptions) {
+		options.timeout = timeout
+	}
+}
+
+// Run the command inside the guest as the user, the first element being
+// the program to execute. A program exiting unsuccessfully is reported
+// through the ExitCode rather than as an error.
+func (machine *Machine) GuestExec(user, password string, cmd []string, options ...GuestExecOption) (*GuestExecResult, error) {
+	return machine.GuestExecContext(context.Background(), user, password, cmd, options...)
+}
+
+// Run the command inside the guest, killing VBoxManage if the context is
+// done first.
+func (machine *Machine) GuestExecContext(ctx context.Context, user, password string, cmd []string, options ...GuestExecOption) (*GuestExecResult, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("virtualbox: no command to run in the guest")
+	}
+	execOptions := new(guestExecOptions)
+	for _, option := range options {
+		option(execOptions)
+	}
+	creds := GuestCredentials{Username: user, Password: password, Domain: execOptions.domain}
+
+	var args []string
+	for _, env := range execOptions.env {
+		args = append(args, "--putenv", env)
+	}
+	if execOptions.workingDir != "" {
+		args = append(args, "--cwd", execOptions.workingDir)
+	}
+	if execOptions.timeout != 0 {
+		args = append(args, "--timeout",
+			strconv.FormatInt(int64(execOptions.timeout/time.Millisecond), 10))
+	}
+	args = append(args, "--wait-stdout", "--wait-stderr", "--exe", cmd[0], "--")
+	args = append(args, cmd...)
+
+	stdout, stderr, err := machine.guestControl(ctx, creds, "run", args...)
+	result := &GuestExecResult{Stdout: stdout, Stderr: stderr}
+	// VBoxManage exits with the status of the guest process, but failing
+	// itself it also prints an error line
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) && commandErr.Message == "" && ctx.Err() == nil {
+		result.ExitCode = commandErr.Err.ExitCode()
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Copy a file or directory between the host and the guest with copyto or
+// copyfrom.
+func (machine *Machine) guestCopy(ctx context.Context, direction string, creds GuestCredentials, source, target string) error {
+	_, _, err := machine.guestControl(ctx, creds, direction, "--recursive", source, target)
+	return err
+}
+
+// Copy a file or directory from the host into the guest as the user.
+func (machine *Machine) GuestCopyTo(user, password, hostPath, guestPath string) error {
+	return machine.guestCopy(context.Background(), "copyto",
+		GuestCredentials{Username: user, Password: password}, hostPath, guestPath)
+}
+
+// Copy a file or directory from the guest to the host as the user.
+func (machine *Machine) GuestCopyFrom(user, password, guestPath, hostPath string) error {
+	return machine.guestCopy(context.Background(), "copyfrom",
+		GuestCredentials{Username: user, Password: password}, guestPath, hostPath)
+}
@@ -0,0 +1,89 @@
+package virtualbox
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type xmlDHCPLeases struct {
+	Leases []xmlDHCPLease `xml:"Lease"`
+}
+
+type xmlDHCPLease struct {
+	MAC     string `xml:"mac,attr"`
+	State   string `xml:"state,attr"`
+	Address struct {
+		Value string `xml:"value,attr"`
+	} `xml:"Address"`
+	Time struct {
+		Issued int64 `xml:"issued,attr"`
+	} `xml:"Time"`
+}
+
+// Get the IPv4 addresses of the guest, as reported by the Guest Additions
+// in interface order. Without the Guest Additions the addresses the
+// VirtualBox DHCP server leased to the host-only adapters are used instead.
+// The result is empty when neither knows an address.
+func (machine *Machine) GuestIPs() ([]string, error) {
+	live, err := machine.EnumerateGuestProperties("/VirtualBox/GuestInfo/Net/*/V4/IP")
+	if err != nil {
+		return nil, err
+	}
+	properties := make([]xmlGuestProperty, 0, len(live))
+	for _, property := range live {
+		properties = append(properties, xmlGuestProperty{Name: property.Name, Value: property.Value})
+	}
+	if ips := guestIPs(properties); len(ips) != 0 {
+		return ips, nil
+	}
+	return machine.leasedIPs()
+}
+
+// Get the addresses leased to the host-only adapters from the lease files
+// of the VirtualBox DHCP server, in adapter order.
+func (machine *Machine) leasedIPs() ([]string, error) {
+	home, err := Home()
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, adapter := range machine.NetworkAdapters {
+		if !adapter.Enabled || adapter.Mode != NetworkHostOnly || adapter.MACAddress == "" {
+			continue
+		}
+		leasesPath := filepath.Join(home, "HostInterfaceNetworking-"+adapter.HostOnlyInterface+"-Dhcpd.leases")
+		data, err := os.ReadFile(leasesPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var leases xmlDHCPLeases
+		err = xml.Unmarshal(data, &leases)
+		if err != nil {
+			return nil, err
+		}
+		mac := strings.ToLower(adapter.MACAddress)
+		var latest *xmlDHCPLease
+		for index := range leases.Leases {
+			lease := &leases.Leases[index]
+			if strings.ToLower(strings.ReplaceAll(lease.MAC, ":", "")) != mac ||
+				lease.State != "acked" || net.ParseIP(lease.Address.Value) == nil {
+				continue
+			}
+			if latest == nil || lease.Time.Issued > latest.Time.Issued {
+				latest = lease
+			}
+		}
+		if latest != nil {
+			ips = append(ips, latest.Address.Value)
+		}
+	}
+	return ips, nil
+}
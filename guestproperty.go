@@ -0,0 +1,119 @@
+package virtualbox
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A guest property, set by the host or by the Guest Additions in the guest.
+type GuestProperty struct {
+	Name      string
+	Value     string
+	Timestamp time.Time // when it was last changed, if reported
+	Flags     string    `json:",omitempty"` // such as TRANSIENT, RDONLYGUEST
+}
+
+// How long each "guestproperty wait" runs before WaitGuestProperty checks
+// the context and waits again, so that waiting does not hold a command slot.
+var guestPropertyWaitTimeout = 10 * time.Second
+
+var (
+	// VirtualBox 6.1 and earlier, and the wait output which has no
+	// timestamp.
+	guestPropertyOldFormat = regexp.MustCompile(
+		`^Name: (.*?), value: (.*?)(?:, timestamp: (\d+))?, flags: ?(.*)$`)
+	// VirtualBox 7.0 and later.
+	guestPropertyNewFormat = regexp.MustCompile(`^(/\S*) = '(.*)' @ (\S+)\s*(.*)$`)
+)
+
+func parseGuestProperty(line string) (GuestProperty, bool) {
+	line = strings.TrimSpace(line)
+	if match := guestPropertyOldFormat.FindStringSubmatch(line); match != nil {
+		property := GuestProperty{Name: match[1], Value: match[2], Flags: match[4]}
+		if nanoseconds, err := strconv.ParseInt(match[3], 10, 64); err == nil {
+			property.Timestamp = time.Unix(0, nanoseconds).UTC()
+		}
+		return property, true
+	}
+	if match := guestPropertyNewFormat.FindStringSubmatch(line); match != nil {
+		property := GuestProperty{Name: match[1], Value: match[2], Flags: match[4]}
+		property.Timestamp, _ = time.Parse(time.RFC3339Nano, match[3])
+		return property, true
+	}
+	return GuestProperty{}, false
+}
+
+// Get the value of the guest property, and whether it is set.
+func (machine *Machine) GetGuestProperty(name string) (string, bool, error) {
+	bytes, err := vboxManage("guestproperty", "get", machine.UUID.String(), name)
+	if err != nil {
+		return "", false, err
+	}
+	value, found := strings.CutPrefix(strings.TrimRight(string(bytes), "\r\n"), "Value: ")
+	if !found {
+		// "No value set!"
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+// Set the guest property, where an empty value removes it. The flags are
+// a comma separated list such as "TRANSIENT,RDONLYGUEST", or empty.
+func (machine *Machine) SetGuestProperty(name, value, flags string) error {
+	args := []string{"guestproperty", "set", machine.UUID.String(), name}
+	if value != "" {
+		args = append(args, value)
+		if flags != "" {
+			args = append(args, "--flags", flags)
+		}
+	}
+	_, err := machine.manage(context.Background(), args...)
+	return err
+}
+
+// Get the guest properties with names matching the pattern, where * and ?
+// are wildcards and | separates alternatives. An empty pattern matches all.
+func (machine *Machine) EnumerateGuestProperties(pattern string) ([]GuestProperty, error) {
+	args := []string{"guestproperty", "enumerate", machine.UUID.String()}
+	if pattern != "" {
+		args = append(args, "--patterns", pattern)
+	}
+	bytes, err := vboxManage(args...)
+	if err != nil {
+		return nil, err
+	}
+	var properties []GuestProperty
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if property, ok := parseGuestProperty(line); ok {
+			properties = append(properties, property)
+		}
+	}
+	return properties, nil
+}
+
+// Wait until a guest property matching the pattern changes, or the context
+// is done, and return it as changed. Changes made before the call are not
+// seen, so check the current value with GetGuestProperty first, for example
+// when waiting for the guest to finish booting.
+func (machine *Machine) WaitGuestProperty(ctx context.Context, pattern string) (*GuestProperty, error) {
+	timeout := strconv.FormatInt(int64(guestPropertyWaitTimeout/time.Millisecond), 10)
+	for {
+		// without --fail-on-timeout a timeout exits cleanly with no output
+		bytes, err := vboxManageContext(ctx, "guestproperty", "wait",
+			machine.UUID.String(), pattern, "--timeout", timeout)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(bytes), "\n") {
+			if property, ok := parseGuestProperty(line); ok {
+				return &property, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type GuestPathOp string
+
+const (
+	GuestPathCreated  = GuestPathOp("created")
+	GuestPathModified = GuestPathOp("modified")
+	GuestPathRemoved  = GuestPathOp("removed")
+)
+
+// A watched path in the guest changed.
+type GuestPathChanged struct {
+	Path string
+	Op   GuestPathOp
+	Size int64     `json:",omitempty"` // in bytes, if reported by the Guest Additions
+	Time time.Time // when the change was seen
+}
+
+var (
+	guestStatSize     = regexp.MustCompile(`(?m)^\s*Size:\s*(\d+)`)
+	guestStatAccess   = regexp.MustCompile(`(?m)^\s*Access:.*$`)
+	guestStatNotFound = regexp.MustCompile(`(?i)no such file|not found|does not exist`)
+)
+
+// Stat the path in the guest, returning the output without the access time
+// so that reading the file does not count as a change. A missing path
+// results in an empty output and no error.
+func (machine *Machine) guestStat(ctx context.Context, creds GuestCredentials, path string) (string, error) {
+	err := machine.checkNamespace()
+	if err != nil {
+		return "", err
+	}
+	credsArgs, remove, err := creds.args()
+	if err != nil {
+		return "", err
+	}
+	defer remove()
+	args := append([]string{"guestcontrol", machine.UUID.String(), "stat"}, credsArgs...)
+	stdout, stderr, err := vboxManageOutputs(ctx, append(args, path)...)
+	var commandErr *CommandError
+	if errors.As(err, &commandErr) && guestStatNotFound.Match(stderr) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return guestStatAccess.ReplaceAllString(string(stdout), ""), nil
+}
+
+// Poll the file or directory in the guest every PollInterval and deliver
+// its changes until the context is done, when the channel is closed. A path
+// that exists when watching starts is delivered as created, so waiting for
+// a result file written by a test does not miss one that is already there.
+// Directories change when entries are added or removed. Polls that fail,
+// such as while the Guest Additions are not running yet, are retried.
+func (machine *Machine) WatchGuestPath(ctx context.Context, creds GuestCredentials, path string) <-chan GuestPathChanged {
+	events := make(chan GuestPathChanged)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+		previous := ""
+		for {
+			current, err := machine.guestStat(ctx, creds, path)
+			if err == nil && current != previous {
+				event := GuestPathChanged{Path: path, Time: time.Now()}
+				switch {
+				case previous == "":
+					event.Op = GuestPathCreated
+				case current == "":
+					event.Op = GuestPathRemoved
+				default:
+					event.Op = GuestPathModified
+				}
+				if match := guestStatSize.FindStringSubmatch(current); match != nil {
+					event.Size, _ = strconv.ParseInt(match[1], 10, 64)
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+				previous = current
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events
+}
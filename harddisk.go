@@ -0,0 +1,91 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// Storage details of a disk image, as given to createmedium --variant.
+type DiskVariant string
+
+const (
+	VariantStandard = DiskVariant("Standard") // dynamically allocated
+	VariantFixed    = DiskVariant("Fixed")
+	VariantSplit2G  = DiskVariant("Split2G") // VMDK only
+	VariantStream   = DiskVariant("Stream")  // VMDK only
+	VariantESX      = DiskVariant("ESX")     // VMDK only
+)
+
+type CreateHardDisk struct {
+	Location string
+	SizeMB   int
+	Format   HardDiskFormat // defaults to VDI
+	Variant  DiskVariant    // defaults to VariantStandard
+}
+
+// Create the disk image with createmedium. The disk is registered in the
+// global media registry until it is attached to a machine.
+func (createDisk CreateHardDisk) Create() (*HardDisk, error) {
+	return createDisk.CreateContext(context.Background())
+}
+
+// Create the disk image, killing VBoxManage if the context is done first.
+func (createDisk CreateHardDisk) CreateContext(ctx context.Context) (*HardDisk, error) {
+	format := createDisk.Format
+	if format == "" {
+		format = VDI
+	}
+	args := []string{"createmedium", "disk",
+		"--filename", createDisk.Location,
+		"--size", strconv.Itoa(createDisk.SizeMB),
+		"--format", string(format)}
+	if createDisk.Variant != "" {
+		args = append(args, "--variant", string(createDisk.Variant))
+	}
+	bytes, err := vboxManageMediumContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	uuids := extractUUIDs(string(bytes))
+	if len(uuids) != 1 {
+		return nil, errors.New("virtualbox: createmedium did not report the UUID")
+	}
+	return &HardDisk{
+		UUID:     *uuids[0],
+		Location: createDisk.Location,
+		Format:   format,
+		Type:     Normal,
+	}, nil
+}
+
+// Grow the disk image to the given size. Shrinking is not supported by
+// VirtualBox.
+func (disk *HardDisk) Resize(sizeMB int) error {
+	_, err := vboxManageMediumContext(context.Background(),
+		"modifymedium", "disk", disk.UUID.String(), "--resize", strconv.Itoa(sizeMB))
+	return err
+}
+
+// Unregister the disk image, also deleting the file if deleteFile is set.
+// The disk must not be attached to any machine.
+func (disk *HardDisk) Delete(deleteFile bool) error {
+	args := []string{"closemedium", "disk", disk.UUID.String()}
+	if deleteFile {
+		args = append(args, "--delete")
+	}
+	_, err := vboxManageModify(args...)
+	return err
+}
+
+// Compact the disk image, reclaiming zeroed blocks.
+func (disk *HardDisk) Compact() error {
+	return disk.CompactContext(context.Background())
+}
+
+// Compact the disk image, killing VBoxManage if the context is done first.
+func (disk *HardDisk) CompactContext(ctx context.Context) error {
+	_, err := vboxManageMediumContext(ctx,
+		"modifymedium", "disk", disk.UUID.String(), "--compact")
+	return err
+}
@@ -0,0 +1,86 @@
+package virtualbox
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+)
+
+// When non-empty VBoxManage is run as this user via "sudo -n -u", which
+// allows admin tooling to inspect VMs owned by another account such as a
+// service user. The current VBOX_USER_HOME is passed through explicitly
+// since sudo does not preserve the environment.
+var RunAs string
+
+// Get the default VBOX_USER_HOME directory for a user home directory, the
+// way VirtualBox picks it. Elsewhere than macOS and Windows an existing
+// ~/.VirtualBox is still used, and otherwise VirtualBox in the XDG config
+// directory, which is ~/.config unless configHome is set.
+func defaultHomeFor(userHome, configHome string) string {
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(userHome, "Library", "VirtualBox")
+	case "windows":
+		return filepath.Join(userHome, ".VirtualBox")
+	}
+	legacy := filepath.Join(userHome, ".VirtualBox")
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	if configHome == "" {
+		configHome = filepath.Join(userHome, ".config")
+	}
+	return filepath.Join(configHome, "VirtualBox")
+}
+
+// Get the VBOX_USER_HOME directory currently in effect.
+func Home() (string, error) {
+	if home := os.Getenv("VBOX_USER_HOME"); home != "" {
+		return home, nil
+	}
+	current, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return defaultHomeFor(current.HomeDir, os.Getenv("XDG_CONFIG_HOME")), nil
+}
+
+// Get the VBOX_USER_HOME directory of the named user, assuming the default
+// XDG config directory.
+func UserHome(username string) (string, error) {
+	other, err := user.Lookup(username)
+	if err != nil {
+		return "", err
+	}
+	return defaultHomeFor(other.HomeDir, ""), nil
+}
+
+// Get the path to the VirtualBox.xml configuration file currently in effect,
+// suitable for passing to Decode.
+func DefaultPath() (string, error) {
+	home, err := Home()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "VirtualBox.xml"), nil
+}
+
+// Point the library at the VirtualBox instance of the named user, optionally
+// running VBoxManage as that user with sudo. Returns the path to that user's
+// VirtualBox.xml.
+func SelectUser(username string, sudo bool) (configPath string, err error) {
+	home, err := UserHome(username)
+	if err != nil {
+		return "", err
+	}
+	err = SetHome(home)
+	if err != nil {
+		return "", err
+	}
+	RunAs = ""
+	if sudo {
+		RunAs = username
+	}
+	return filepath.Join(home, "VirtualBox.xml"), nil
+}
@@ -0,0 +1,164 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// The tag exempting a machine from an IdlePolicy with no ExemptTag set.
+const DefaultIdleExemptTag = "no-autosuspend"
+
+// Saves the state of running machines that were idle for a while, to free
+// the memory they hold on a developer workstation. A machine is idle while
+// its CPU load stays below the threshold, nobody is connected over VRDE and
+// the Guest Additions report no user in use of the guest. Machines tagged
+// with the exempt tag are never suspended.
+type IdlePolicy struct {
+	Window       time.Duration // how long a machine must be idle, 30 minutes if zero
+	CPUThreshold float64       // user and kernel load in percent, 5 if zero
+	Interval     time.Duration // between checks, a minute if zero
+	ExemptTag    string        // DefaultIdleExemptTag if empty
+
+	OnSuspend func(machine *Machine) // optional
+	OnError   func(err error)        // optional
+
+	collector *metricsCollector
+	idleSince map[uuid.UUID]time.Time
+}
+
+func (policy *IdlePolicy) reportError(err error) {
+	if err != nil && policy.OnError != nil {
+		policy.OnError(err)
+	}
+}
+
+// Check if the machine has a VRDE client or a guest user in use.
+func (machine *Machine) inUse() (bool, error) {
+	info, err := showVMInfo(machine.UUID.String())
+	if err != nil {
+		return false, err
+	}
+	if info["VRDEActiveConnection"] == "on" {
+		return true, nil
+	}
+	properties, err := machine.EnumerateGuestProperties("/VirtualBox/GuestInfo/User/*/UsageState")
+	if err != nil {
+		return false, err
+	}
+	for _, property := range properties {
+		if property.Value == "InUse" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Check the running machines once, saving the state of those idle for the
+// whole window. Problems with single machines are reported to OnError.
+func (policy *IdlePolicy) Check(ctx context.Context) error {
+	threshold, window, exemptTag := policy.CPUThreshold, policy.Window, policy.ExemptTag
+	if threshold == 0 {
+		threshold = 5
+	}
+	if window == 0 {
+		window = 30 * time.Minute
+	}
+	if exemptTag == "" {
+		exemptTag = DefaultIdleExemptTag
+	}
+	if policy.collector == nil {
+		policy.collector = &metricsCollector{
+			metrics: []string{"CPU/Load/User", "CPU/Load/Kernel"},
+			period:  policy.interval(),
+		}
+		policy.idleSince = make(map[uuid.UUID]time.Time)
+	}
+	values, err := policy.collector.query(ctx)
+	if err != nil {
+		return err
+	}
+	load := make(map[string]float64)
+	for _, value := range values {
+		if value.Unit == "%" {
+			load[value.Object] += value.Values[len(value.Values)-1]
+		}
+	}
+	running, err := runningMachines(ctx)
+	if err != nil {
+		return err
+	}
+	for machineUUID := range policy.idleSince {
+		if !running[machineUUID] {
+			delete(policy.idleSince, machineUUID)
+		}
+	}
+
+	now := time.Now()
+	for machineUUID := range running {
+		machine, err := LoadMachine(machineUUID.String())
+		if errors.Is(err, ErrOutsideNamespace) {
+			continue
+		}
+		if err != nil {
+			policy.reportError(err)
+			continue
+		}
+		cpu, measured := load[machine.Name]
+		idle := machine.Status == Running && measured && cpu < threshold && !machine.hasTag(exemptTag)
+		if idle {
+			inUse, err := machine.inUse()
+			policy.reportError(err)
+			idle = err == nil && !inUse
+		}
+		if !idle {
+			delete(policy.idleSince, machineUUID)
+			continue
+		}
+		since, known := policy.idleSince[machineUUID]
+		if !known {
+			policy.idleSince[machineUUID] = now
+			continue
+		}
+		if now.Sub(since) < window {
+			continue
+		}
+		err = machine.SaveState()
+		if err != nil {
+			policy.reportError(err)
+			continue
+		}
+		delete(policy.idleSince, machineUUID)
+		if policy.OnSuspend != nil {
+			policy.OnSuspend(machine)
+		}
+	}
+	return nil
+}
+
+func (policy *IdlePolicy) interval() time.Duration {
+	if policy.Interval == 0 {
+		return time.Minute
+	}
+	return policy.Interval
+}
+
+// Check the machines every Interval until the context is done.
+func (policy *IdlePolicy) Run(ctx context.Context) error {
+	ticker := time.NewTicker(policy.interval())
+	defer ticker.Stop()
+	for {
+		err := policy.Check(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		policy.reportError(err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The OVF version written by Machine.Export.
+type OVFVersion string
+
+const (
+	OVF09 = OVFVersion("ovf09")
+	OVF10 = OVFVersion("ovf10") // the VirtualBox default
+	OVF20 = OVFVersion("ovf20")
+	OPC10 = OVFVersion("opc10") // Oracle Cloud Infrastructure
+)
+
+// A virtual system of an appliance, as VirtualBox suggests importing it.
+// Change the fields before passing it back in ImportOptions to remap it.
+type ApplianceSystem struct {
+	Index      int // as in --vsys
+	Name       string
+	OSType     OSType
+	Group      string `json:",omitempty"`
+	BaseFolder string `json:",omitempty"`
+	CPUs       int    `json:",omitempty"`
+	Memory     int    `json:",omitempty"`
+	Disks      []ApplianceDisk
+}
+
+type ApplianceDisk struct {
+	Unit   int // as in --unit
+	Source string
+	Target string // the path of the imported image
+}
+
+type ImportOptions struct {
+	Systems     []ApplianceSystem // as returned by InspectAppliance, all as suggested if nil
+	KeepMACs    bool              // keep the MAC addresses of all network adapters
+	KeepNATMACs bool              // keep only those of NAT adapters
+	ImportToVDI bool              // convert the disk images to VDI
+}
+
+var (
+	dryRunSystem = regexp.MustCompile(`^Virtual system (\d+):`)
+	dryRunUnit   = regexp.MustCompile(`^\s*(\d+): (.*)$`)
+	dryRunValue  = regexp.MustCompile(`^Suggested (OS type:|VM name|VM group|VM base folder) "(.*)"`)
+	dryRunNumber = regexp.MustCompile(`^(Number of CPUs|Guest memory): (\d+)`)
+	dryRunDisk   = regexp.MustCompile(`^Hard disk image: source image=(.*), target path=(.*), controller=`)
+)
+
+// Parse the virtual systems from the output of "import --dry-run".
+func parseImportDryRun(text string) []ApplianceSystem {
+	var systems []ApplianceSystem
+	var system *ApplianceSystem
+	for _, line := range strings.Split(text, "\n") {
+		if match := dryRunSystem.FindStringSubmatch(line); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			systems = append(systems, ApplianceSystem{Index: index})
+			system = &systems[len(systems)-1]
+			continue
+		}
+		match := dryRunUnit.FindStringSubmatch(line)
+		if match == nil || system == nil {
+			continue
+		}
+		unit, _ := strconv.Atoi(match[1])
+		description := match[2]
+		if value := dryRunValue.FindStringSubmatch(description); value != nil {
+			switch value[1] {
+			case "OS type:":
+				system.OSType = OSType(value[2])
+			case "VM name":
+				system.Name = value[2]
+			case "VM group":
+				system.Group = value[2]
+			case "VM base folder":
+				system.BaseFolder = value[2]
+			}
+		} else if number := dryRunNumber.FindStringSubmatch(description); number != nil {
+			count, _ := strconv.Atoi(number[2])
+			if number[1] == "Number of CPUs" {
+				system.CPUs = count
+			} else {
+				system.Memory = count
+			}
+		} else if disk := dryRunDisk.FindStringSubmatch(description); disk != nil {
+			system.Disks = append(system.Disks, ApplianceDisk{
+				Unit:   unit,
+				Source: disk[1],
+				Target: disk[2],
+			})
+		}
+	}
+	return systems
+}
+
+// Get the virtual systems of the OVF or OVA at the path with the names,
+// hardware and disk paths VirtualBox would import them with.
+func InspectAppliance(path string) ([]ApplianceSystem, error) {
+	bytes, err := vboxManage("import", path, "--dry-run")
+	if err != nil {
+		return nil, err
+	}
+	systems := parseImportDryRun(string(bytes))
+	if len(systems) == 0 {
+		return nil, errors.New("virtualbox: no virtual systems found in " + path)
+	}
+	return systems, nil
+}
+
+// Import the appliance at the path, applying the changes made to the
+// systems in the options, and add the imported machines to the maps.
+func (vbox *VirtualBox) ImportAppliance(path string, options ImportOptions) ([]*Machine, error) {
+	ctx := context.Background()
+	systems := options.Systems
+	if systems == nil {
+		var err error
+		systems, err = InspectAppliance(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"import", path}
+	for _, system := range systems {
+		err := ValidateMachineName(system.Name)
+		if err != nil {
+			return nil, err
+		}
+		var groups []string
+		if system.Group != "" && system.Group != "/" {
+			groups = []string{system.Group}
+		}
+		if !inNamespace(system.Name, groups) {
+			return nil, ErrOutsideNamespace
+		}
+		vsys := strconv.Itoa(system.Index)
+		args = append(args, "--vsys", vsys, "--vmname", system.Name)
+		if system.OSType != "" {
+			args = append(args, "--ostype", string(system.OSType))
+		}
+		if system.Group != "" {
+			args = append(args, "--group", system.Group)
+		}
+		if system.BaseFolder != "" {
+			args = append(args, "--basefolder", system.BaseFolder)
+		}
+		if system.CPUs != 0 {
+			args = append(args, "--cpus", strconv.Itoa(system.CPUs))
+		}
+		if system.Memory != 0 {
+			args = append(args, "--memory", strconv.Itoa(system.Memory))
+		}
+		for _, disk := range system.Disks {
+			args = append(args, "--vsys", vsys,
+				"--unit", strconv.Itoa(disk.Unit), "--disk", disk.Target)
+		}
+	}
+	var importOptions []string
+	if options.KeepMACs {
+		importOptions = append(importOptions, "keepallmacs")
+	}
+	if options.KeepNATMACs {
+		importOptions = append(importOptions, "keepnatmacs")
+	}
+	if options.ImportToVDI {
+		importOptions = append(importOptions, "importtovdi")
+	}
+	if len(importOptions) != 0 {
+		args = append(args, "--options", strings.Join(importOptions, ","))
+	}
+	_, err := vboxManageMediumContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	InvalidateStatusCache()
+
+	machines := make([]*Machine, 0, len(systems))
+	for _, system := range systems {
+		found, _, err := showMachine(ctx, system.Name)
+		if err != nil {
+			return machines, err
+		}
+		machine, media, err := decodeMachineFile(&found.UUID, found.Source)
+		if err != nil {
+			return machines, err
+		}
+		vbox.add(machine, media)
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+// Export the machine as an OVF, or an OVA if the path ends in .ova, in the
+// given version of the format, the VirtualBox default if empty.
+func (machine *Machine) Export(path string, format OVFVersion) error {
+	args := []string{"export", machine.UUID.String(), "--output", path}
+	if format != "" {
+		args = append(args, "--"+string(format))
+	}
+	_, err := machine.manageMedium(context.Background(), args...)
+	return err
+}
@@ -0,0 +1,298 @@
+package virtualbox
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type libvirtDomain struct {
+	XMLName  xml.Name        `xml:"domain"`
+	Type     string          `xml:"type,attr"`
+	Name     string          `xml:"name"`
+	UUID     string          `xml:"uuid"`
+	Memory   libvirtMemory   `xml:"memory"`
+	VCPU     int             `xml:"vcpu"`
+	OS       libvirtOS       `xml:"os"`
+	Features libvirtFeatures `xml:"features"`
+	Clock    libvirtClock    `xml:"clock"`
+	Devices  libvirtDevices  `xml:"devices"`
+}
+
+type libvirtMemory struct {
+	Unit  string `xml:"unit,attr"`
+	Value int    `xml:",chardata"`
+}
+
+type libvirtOS struct {
+	Firmware string          `xml:"firmware,attr,omitempty"`
+	Type     libvirtOSType   `xml:"type"`
+	Boot     []libvirtDevRef `xml:"boot"`
+}
+
+type libvirtOSType struct {
+	Arch  string `xml:"arch,attr"`
+	Value string `xml:",chardata"`
+}
+
+type libvirtDevRef struct {
+	Dev string `xml:"dev,attr"`
+}
+
+type libvirtEmpty struct{}
+
+type libvirtFeatures struct {
+	ACPI libvirtEmpty  `xml:"acpi"`
+	APIC *libvirtEmpty `xml:"apic"`
+	PAE  *libvirtEmpty `xml:"pae"`
+}
+
+type libvirtClock struct {
+	Offset string `xml:"offset,attr"`
+}
+
+type libvirtDevices struct {
+	Disks      []libvirtDisk      `xml:"disk"`
+	Interfaces []libvirtInterface `xml:"interface"`
+}
+
+type libvirtDisk struct {
+	Type     string         `xml:"type,attr"`
+	Device   string         `xml:"device,attr"`
+	Driver   libvirtDriver  `xml:"driver"`
+	Source   *libvirtSource `xml:"source"`
+	Target   libvirtTarget  `xml:"target"`
+	ReadOnly *libvirtEmpty  `xml:"readonly"`
+	Comment  string         `xml:",comment"`
+}
+
+type libvirtDriver struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type libvirtSource struct {
+	File    string `xml:"file,attr,omitempty"`
+	Bridge  string `xml:"bridge,attr,omitempty"`
+	Network string `xml:"network,attr,omitempty"`
+}
+
+type libvirtTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+type libvirtInterface struct {
+	Type    string          `xml:"type,attr"`
+	MAC     *libvirtAddress `xml:"mac"`
+	Source  *libvirtSource  `xml:"source"`
+	Model   libvirtModel    `xml:"model"`
+	Comment string          `xml:",comment"`
+}
+
+type libvirtAddress struct {
+	Address string `xml:"address,attr"`
+}
+
+type libvirtModel struct {
+	Type string `xml:"type,attr"`
+}
+
+// The disk bus and device name prefix for the controller types.
+var libvirtBuses = map[string][2]string{
+	"PIIX3":       {"ide", "hd"},
+	"PIIX4":       {"ide", "hd"},
+	"ICH6":        {"ide", "hd"},
+	"AHCI":        {"sata", "sd"},
+	"LsiLogic":    {"scsi", "sd"},
+	"BusLogic":    {"scsi", "sd"},
+	"LsiLogicSas": {"scsi", "sd"},
+	"VirtioSCSI":  {"scsi", "sd"},
+	"USB":         {"usb", "sd"},
+	"NVMe":        {"sata", "sd"}, // QEMU NVMe needs a separate controller
+	"I82078":      {"fdc", "fd"},
+}
+
+// QEMU names of the disk image formats it can read.
+var libvirtDiskFormats = map[HardDiskFormat]string{
+	"VDI":       "vdi",
+	"VMDK":      "vmdk",
+	"VHD":       "vpc",
+	"VHDX":      "vhdx",
+	"Parallels": "parallels",
+	"QED":       "qed",
+	"QCOW":      "qcow",
+	"RAW":       "raw",
+	"DMG":       "dmg",
+}
+
+// QEMU models of the emulated network hardware.
+var libvirtNICModels = map[string]string{
+	"Am79C970A": "pcnet",
+	"Am79C973":  "pcnet",
+	"82540EM":   "e1000",
+	"82543GC":   "e1000",
+	"82545EM":   "e1000",
+	"virtio":    "virtio",
+}
+
+// Get the device name at the index, such as sda, sdb and sdaa after sdz.
+func libvirtDeviceName(prefix string, index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('a'+(index-1)%26)) + name
+	}
+	return prefix + name
+}
+
+// Format a MAC address stored without separators, such as 080027C3A1B2.
+func libvirtMAC(address string) string {
+	if len(address) != 12 {
+		return address
+	}
+	parts := make([]string, 0, 6)
+	for index := 0; index < 12; index += 2 {
+		parts = append(parts, strings.ToLower(address[index:index+2]))
+	}
+	return strings.Join(parts, ":")
+}
+
+func (vbox *VirtualBox) libvirtDomain(machine *Machine) *libvirtDomain {
+	domain := &libvirtDomain{
+		Type:   "kvm",
+		Name:   machine.Name,
+		UUID:   machine.UUID.String(),
+		Memory: libvirtMemory{Unit: "MiB", Value: machine.Memory},
+		VCPU:   machine.CPUs,
+		OS:     libvirtOS{Type: libvirtOSType{Arch: "x86_64", Value: "hvm"}},
+		Clock:  libvirtClock{Offset: "localtime"},
+	}
+	if strings.EqualFold(machine.Architecture, "ARM") {
+		domain.OS.Type.Arch = "aarch64"
+	} else if !strings.HasSuffix(string(machine.OSType), "_64") {
+		domain.OS.Type.Arch = "i686"
+	}
+	if machine.Firmware != "" && machine.Firmware != BIOS {
+		domain.OS.Firmware = "efi"
+	}
+	if machine.IOAPIC {
+		domain.Features.APIC = &libvirtEmpty{}
+	}
+	if machine.PAE {
+		domain.Features.PAE = &libvirtEmpty{}
+	}
+	if machine.RTCUseUTC {
+		domain.Clock.Offset = "utc"
+	}
+
+	used := make(map[string]int)
+	for _, controller := range machine.StorageControllers {
+		bus, ok := libvirtBuses[controller.Type]
+		if !ok {
+			bus = [2]string{"sata", "sd"}
+		}
+		devices := append([]AttachedDevice(nil), controller.Devices...)
+		sort.Slice(devices, func(i, j int) bool {
+			if devices[i].Port != devices[j].Port {
+				return devices[i].Port < devices[j].Port
+			}
+			return devices[i].Device < devices[j].Device
+		})
+		for _, device := range devices {
+			disk := libvirtDisk{
+				Type:   "file",
+				Device: "disk",
+				Driver: libvirtDriver{Name: "qemu"},
+				Target: libvirtTarget{Dev: libvirtDeviceName(bus[1], used[bus[1]]), Bus: bus[0]},
+			}
+			used[bus[1]]++
+			switch device.Type {
+			case "DVD":
+				disk.Device = "cdrom"
+				disk.Driver.Type = "raw"
+				disk.ReadOnly = &libvirtEmpty{}
+			case "Floppy":
+				disk.Device = "floppy"
+				disk.Driver.Type = "raw"
+			}
+			if device.Medium != nil {
+				if hardDisk := vbox.HardDisks[*device.Medium]; hardDisk != nil {
+					disk.Source = &libvirtSource{File: hardDisk.Location}
+					disk.Driver.Type = libvirtDiskFormats[hardDisk.Format]
+					if hardDisk.Parent != nil {
+						disk.Comment = " differencing image, merge the chain with qemu-img convert first "
+					}
+				}
+			}
+			domain.Devices.Disks = append(domain.Devices.Disks, disk)
+		}
+	}
+
+	for _, device := range machine.BootOrder {
+		switch device {
+		case BootDisk:
+			domain.OS.Boot = append(domain.OS.Boot, libvirtDevRef{Dev: "hd"})
+		case BootDVD:
+			domain.OS.Boot = append(domain.OS.Boot, libvirtDevRef{Dev: "cdrom"})
+		case BootFloppy:
+			domain.OS.Boot = append(domain.OS.Boot, libvirtDevRef{Dev: "fd"})
+		case BootNetwork:
+			domain.OS.Boot = append(domain.OS.Boot, libvirtDevRef{Dev: "network"})
+		}
+	}
+
+	for _, adapter := range machine.NetworkAdapters {
+		if !adapter.Enabled || adapter.Mode == NetworkNone {
+			continue
+		}
+		nic := libvirtInterface{Model: libvirtModel{Type: libvirtNICModels[adapter.Type]}}
+		if nic.Model.Type == "" {
+			nic.Model.Type = "e1000"
+		}
+		if adapter.MACAddress != "" {
+			nic.MAC = &libvirtAddress{Address: libvirtMAC(adapter.MACAddress)}
+		}
+		switch adapter.Mode {
+		case NetworkNAT:
+			nic.Type = "user"
+			if len(adapter.Forwards) != 0 {
+				nic.Comment = " NAT port forwarding rules are not converted "
+			}
+		case NetworkBridged:
+			nic.Type = "bridge"
+			nic.Source = &libvirtSource{Bridge: adapter.BridgedInterface}
+		case NetworkHostOnly:
+			nic.Type = "network"
+			nic.Source = &libvirtSource{Network: adapter.HostOnlyInterface}
+		case NetworkInternal:
+			nic.Type = "network"
+			nic.Source = &libvirtSource{Network: adapter.InternalNetwork}
+		case NetworkNATNetwork:
+			nic.Type = "network"
+			nic.Source = &libvirtSource{Network: adapter.NATNetwork}
+		default:
+			continue
+		}
+		domain.Devices.Interfaces = append(domain.Devices.Interfaces, nic)
+	}
+	return domain
+}
+
+// Render the machine as a libvirt domain XML skeleton with its CPUs,
+// memory, disks and network adapters, to define an equivalent KVM guest
+// with "virsh define". Networks are referenced by their VirtualBox names
+// and need matching libvirt networks or bridges. This is experimental and
+// covers only the basic hardware.
+func (vbox *VirtualBox) WriteLibvirtDomain(w io.Writer, machine *Machine) error {
+	vbox.mutex.RLock()
+	domain := vbox.libvirtDomain(machine)
+	vbox.mutex.RUnlock()
+	data, err := xml.MarshalIndent(domain, "", "  ")
+	if err != nil {
+		return fmt.Errorf("virtualbox: rendering libvirt domain: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
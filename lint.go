@@ -0,0 +1,64 @@
+package virtualbox
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A likely misconfiguration found by Lint.
+type Finding struct {
+	Rule   string
+	Detail string
+	Fix    [][]string `json:",omitempty"` // VBoxManage invocations that resolve it
+}
+
+// Check the machine against best practices for unattended machines: headless
+// machines should not play audio and should be reachable over VRDE, multiple
+// CPUs need the IOAPIC, disk images should not live on FAT volumes where
+// files are limited to 4GB, and NAT adapters are only reachable through port
+// forwarding rules.
+func (vbox *VirtualBox) Lint(machine *Machine) (findings []Finding) {
+	id := machine.UUID.String()
+	headless := machine.Frontend == Headless
+
+	if headless && machine.Audio {
+		findings = append(findings, Finding{
+			Rule:   "HeadlessAudio",
+			Detail: "headless machine has audio output enabled",
+		})
+	}
+	if headless && !machine.VRDEEnabled {
+		findings = append(findings, Finding{
+			Rule:   "HeadlessWithoutVRDE",
+			Detail: "headless machine has no VRDE server to reach its console",
+			Fix:    [][]string{{"modifyvm", id, "--vrde", "on"}},
+		})
+	}
+	if machine.CPUs > 1 && !machine.IOAPIC {
+		findings = append(findings, Finding{
+			Rule:   "CPUsWithoutIOAPIC",
+			Detail: fmt.Sprintf("%d CPUs require the IOAPIC", machine.CPUs),
+			Fix:    [][]string{{"modifyvm", id, "--ioapic", "on"}},
+		})
+	}
+	for _, disk := range vbox.machineDiskTree(machine) {
+		if disk.Format != VDI {
+			continue
+		}
+		if fat, err := onFATFilesystem(disk.Location); err == nil && fat {
+			findings = append(findings, Finding{
+				Rule:   "VDIOnFAT",
+				Detail: fmt.Sprintf("%s is on a FAT filesystem limited to 4GB files", disk.Location),
+			})
+		}
+	}
+	for _, adapter := range machine.NetworkAdapters {
+		if adapter.Enabled && adapter.Mode == NetworkNAT && len(adapter.Forwards) == 0 {
+			findings = append(findings, Finding{
+				Rule:   "NATWithoutForwarding",
+				Detail: "NAT adapter " + strconv.Itoa(adapter.Slot) + " has no port forwarding rules",
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package virtualbox
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"os"
+	"os/exec"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+var ErrMachineNotFound = errors.New("virtualbox: machine not found")
+
+// Find the registry entry for the machine. UUIDs are looked up in the
+// VirtualBox.xml at DefaultPath, and names, or UUIDs missing from it, are
+// resolved by showvminfo unless in Offline mode.
+func findMachineEntry(ctx context.Context, nameOrUUID string) (*xmlMachineListEntry, error) {
+	if machineUUID, err := uuid.ParseHex(nameOrUUID); err == nil {
+		configPath, err := DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(configPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		machineList := new(xmlMachineList)
+		if err == nil {
+			err = xml.Unmarshal(data, machineList)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, entry := range machineList.Machines {
+			entryUUID, err := uuid.ParseHex(entry.UUID)
+			if err == nil && *entryUUID == *machineUUID {
+				return &entry, nil
+			}
+		}
+	}
+	if Offline {
+		return nil, ErrMachineNotFound
+	}
+	machine, _, err := showMachine(ctx, nameOrUUID)
+	if err != nil {
+		return nil, err
+	}
+	return &xmlMachineListEntry{UUID: machine.UUID.String(), Source: machine.Source}, nil
+}
+
+// Load a single machine by UUID or name, decoding only its settings file
+// instead of the whole inventory. The Status is found the same way as in
+// Decode. Machines outside the namespace result in ErrOutsideNamespace.
+func LoadMachine(nameOrUUID string) (machine *Machine, err error) {
+	ctx, endSpan := startSpan(context.Background(), "LoadMachine", nil)
+	defer func() { endSpan(err) }()
+
+	var running map[uuid.UUID]bool
+	if !Offline {
+		running, err = runningMachines(ctx)
+		if errors.Is(err, exec.ErrNotFound) {
+			running, err = nil, nil
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	entry, err := findMachineEntry(ctx, nameOrUUID)
+	if err != nil {
+		return
+	}
+	machine, _, err = decodeMachine(*entry, running, nil)
+	if err == nil && machine == nil {
+		err = ErrOutsideNamespace
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package virtualbox
+
+import (
+	"path/filepath"
+	"sort"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Get the machine with the name, or nil if there is none.
+func (vbox *VirtualBox) MachineByName(name string) *Machine {
+	vbox.mutex.RLock()
+	defer vbox.mutex.RUnlock()
+	for _, machine := range vbox.Machines {
+		if machine.Name == name {
+			return machine
+		}
+	}
+	return nil
+}
+
+// Get the machines with the status, ordered by name.
+func (vbox *VirtualBox) MachinesByState(status Status) []*Machine {
+	vbox.mutex.RLock()
+	defer vbox.mutex.RUnlock()
+	var machines []*Machine
+	for _, machine := range vbox.Machines {
+		if machine.Status == status {
+			machines = append(machines, machine)
+		}
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+	return machines
+}
+
+// Get the disk image stored at the path, or nil if there is none.
+func (vbox *VirtualBox) HardDiskByLocation(location string) *HardDisk {
+	location = filepath.Clean(location)
+	vbox.mutex.RLock()
+	defer vbox.mutex.RUnlock()
+	for _, disk := range vbox.HardDisks {
+		if filepath.Clean(disk.Location) == location {
+			return disk
+		}
+	}
+	return nil
+}
+
+// Get the differencing chain of the disk, starting at its base image and
+// ending with the disk itself. The chain stops early at a parent that is
+// not known, and is empty for an unknown disk.
+func (vbox *VirtualBox) DiskChain(diskUUID uuid.UUID) []*HardDisk {
+	vbox.mutex.RLock()
+	defer vbox.mutex.RUnlock()
+	var chain []*HardDisk
+	seen := make(map[uuid.UUID]bool)
+	for disk := vbox.HardDisks[diskUUID]; disk != nil && !seen[disk.UUID]; {
+		seen[disk.UUID] = true
+		chain = append(chain, disk)
+		if disk.Parent == nil {
+			break
+		}
+		disk = vbox.HardDisks[*disk.Parent]
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
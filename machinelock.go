@@ -0,0 +1,59 @@
+package virtualbox
+
+import (
+	"context"
+	"sync"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// A lock held while a command changes a machine, counting the callers using
+// it so it can be dropped once nobody does.
+type machineLock struct {
+	held  chan struct{}
+	users int
+}
+
+var machineLocks struct {
+	sync.Mutex
+	locks map[uuid.UUID]*machineLock
+}
+
+// Wait until no other command changing the machine runs, or the context is
+// done, returning the function that lets the next one run. VirtualBox fails
+// concurrent changes to a machine with errors about its session being
+// locked, while changes to different machines can run in parallel. The lock
+// is only held for a single command, so operations can never wait on each
+// other in a cycle.
+func lockMachine(ctx context.Context, machineUUID uuid.UUID) (unlock func(), err error) {
+	machineLocks.Lock()
+	if machineLocks.locks == nil {
+		machineLocks.locks = make(map[uuid.UUID]*machineLock)
+	}
+	lock := machineLocks.locks[machineUUID]
+	if lock == nil {
+		lock = &machineLock{held: make(chan struct{}, 1)}
+		machineLocks.locks[machineUUID] = lock
+	}
+	lock.users++
+	machineLocks.Unlock()
+
+	done := func() {
+		machineLocks.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(machineLocks.locks, machineUUID)
+		}
+		machineLocks.Unlock()
+	}
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			done()
+		}, nil
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,440 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// The medium types printed by "list hdds", as named in the machine XML.
+var listedHardDiskTypes = map[string]HardDiskType{
+	"normal":       Normal,
+	"immutable":    Immutable,
+	"writethrough": HardDiskType("Writethrough"),
+	"shareable":    HardDiskType("Shareable"),
+	"readonly":     HardDiskType("Readonly"),
+	"multiattach":  HardDiskType("MultiAttach"),
+}
+
+// Load the inventory from "list vms", "showvminfo --machinereadable" and
+// "list hdds" instead of the XML files, for settings formats Decode does not
+// understand. Settings that VBoxManage does not print, such as the
+// SettingsVersion, NVRAM and the auto reset flag of disks, are left zero,
+// and the Status is the state reported by showvminfo. Controller types use
+// the names printed by showvminfo, such as IntelAhci instead of AHCI.
+func LoadFromVBoxManage() (vbox *VirtualBox, err error) {
+	return LoadFromVBoxManageContext(context.Background())
+}
+
+// Load the inventory from VBoxManage, killing it if the context is done
+// first.
+func LoadFromVBoxManageContext(ctx context.Context) (vbox *VirtualBox, err error) {
+	ctx, endSpan := startSpan(ctx, "LoadFromVBoxManage", nil)
+	defer func() { endSpan(err) }()
+
+	if Offline {
+		return nil, errors.New("virtualbox: VBoxManage is not used in Offline mode")
+	}
+
+	bytes, err := vboxManageContext(ctx, "list", "hdds")
+	if err != nil {
+		return nil, err
+	}
+	allDisks, err := parseListedHardDisks(string(bytes))
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err = vboxManageContext(ctx, "list", "vms")
+	if err != nil {
+		return nil, err
+	}
+	machineUUIDs, err := parseListedMachines(string(bytes))
+	if err != nil {
+		return nil, err
+	}
+
+	full := &VirtualBox{Machines: make(MachineMap), HardDisks: allDisks}
+	for _, machineUUID := range machineUUIDs {
+		bytes, err := vboxManageContext(ctx, "showvminfo", machineUUID.String(), "--machinereadable")
+		if err != nil {
+			return nil, err
+		}
+		machine, err := parseMachineInfo(string(bytes), allDisks)
+		if err != nil {
+			return nil, err
+		}
+		if inNamespace(machine.Name, machine.Groups) {
+			full.Machines[machine.UUID] = machine
+		}
+	}
+
+	// like Decode, only keep the disks of the machines that were loaded
+	vbox = &VirtualBox{Machines: full.Machines, HardDisks: make(HardDiskMap)}
+	for _, machine := range full.Machines {
+		for diskUUID, disk := range full.MachineHardDisks(machine) {
+			vbox.HardDisks[diskUUID] = disk
+		}
+	}
+	return vbox, nil
+}
+
+// Get the machine UUIDs from the "name" {uuid} lines of "list vms".
+func parseListedMachines(text string) ([]*uuid.UUID, error) {
+	var uuids []*uuid.UUID
+	for _, line := range strings.Split(text, "\n") {
+		index := strings.LastIndex(line, "{")
+		if index < 0 {
+			continue
+		}
+		machineUUID, err := uuid.ParseHex(strings.TrimSpace(line[index:]))
+		if err != nil {
+			return nil, err
+		}
+		uuids = append(uuids, machineUUID)
+	}
+	return uuids, nil
+}
+
+// Parse the blocks of "Key: value" lines printed by "list hdds", linking
+// the differencing disks to their parents.
+func parseListedHardDisks(text string) (HardDiskMap, error) {
+	disks := make(HardDiskMap)
+	var parents []*HardDisk
+	for _, block := range strings.Split(text, "\n\n") {
+		values := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			key, value, found := strings.Cut(line, ":")
+			if found {
+				values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		if values["UUID"] == "" {
+			continue
+		}
+		diskUUID, err := uuid.ParseHex(values["UUID"])
+		if err != nil {
+			return nil, err
+		}
+		diskType, _, _ := strings.Cut(values["Type"], " ")
+		disk := &HardDisk{
+			UUID:     *diskUUID,
+			Location: values["Location"],
+			Format:   HardDiskFormat(values["Storage format"]),
+			Type:     listedHardDiskTypes[diskType],
+		}
+		if parent := values["Parent UUID"]; parent != "" && parent != "base" {
+			disk.Parent, err = uuid.ParseHex(parent)
+			if err != nil {
+				return nil, err
+			}
+			parents = append(parents, disk)
+		}
+		disks[disk.UUID] = disk
+	}
+	for _, disk := range parents {
+		if parent := disks[*disk.Parent]; parent != nil {
+			parent.Children = append(parent.Children, &disk.UUID)
+		}
+	}
+	return disks, nil
+}
+
+// Check if a machine readable value is "on".
+func machineReadableFlag(value string) bool {
+	return value == "on"
+}
+
+// Convert a machine readable number, treating invalid numbers as unset.
+func machineReadableInt(value string) int {
+	number, _ := strconv.Atoi(value)
+	return number
+}
+
+// Build a machine from the showvminfo --machinereadable output. The disks
+// tell hard disk attachments apart from DVD images.
+func parseMachineInfo(text string, disks HardDiskMap) (*Machine, error) {
+	info := parseMachineReadable(text)
+	machineUUID, err := uuid.ParseHex(info["UUID"])
+	if err != nil {
+		return nil, err
+	}
+	machine := &Machine{
+		UUID:        *machineUUID,
+		Name:        info["name"],
+		Source:      info["CfgFile"],
+		OSType:      OSType(info["ostype"]),
+		Status:      parseVMState(info["VMState"]),
+		VRDEEnabled: machineReadableFlag(info["vrde"]),
+		CPUs:        machineReadableInt(info["cpus"]),
+		CPUHotPlug:  machineReadableFlag(info["cpuhotplug"]),
+		CPUCap:      machineReadableInt(info["cpuexecutioncap"]),
+		Memory:      machineReadableInt(info["memory"]),
+		Firmware:    parseFirmware(info["firmware"]),
+		TPM:         TPMNone,
+		TPMLocation: info["tpm_location"],
+		Chipset:     PIIX3,
+		IOAPIC:      machineReadableFlag(info["ioapic"]),
+		HPET:        machineReadableFlag(info["hpet"]),
+		RTCUseUTC:   machineReadableFlag(info["rtcuseutc"]),
+		Audio:       info["audio"] != "" && info["audio"] != "none" && info["audio_out"] != "off",
+		VRAM:        machineReadableInt(info["vram"]),
+		PAE:         machineReadableFlag(info["pae"]),
+
+		NestedPaging: info["nestedpaging"] != "off",
+
+		BIOSTimeOffset:  time.Duration(machineReadableInt(info["biossystemtimeoffset"])) * time.Millisecond,
+		LastStateChange: parseStateChangeTime(info["VMStateChangeTime"]),
+
+		VRDE: &VRDE{
+			AuthType:        VRDEAuthNull,
+			AuthLibrary:     info["vrdeauthlibrary"],
+			AuthTimeout:     defaultVRDEAuthTimeout,
+			MultiConnection: machineReadableFlag(info["vrdemulticon"]),
+		},
+	}
+	if tpm := info["tpm_type"]; tpm != "" {
+		machine.TPM = TPMType(tpm)
+	}
+	if chipset := info["chipset"]; chipset != "" {
+		machine.Chipset = Chipset(strings.ToLower(chipset))
+	}
+	machine.BootMenu = BootMenuMode(info["bootmenu"])
+	for position := 1; position <= MaxBootDevices; position++ {
+		device := BootDevice(info["boot"+strconv.Itoa(position)])
+		if device != "" && device != BootNone {
+			machine.BootOrder = append(machine.BootOrder, device)
+		}
+	}
+	if frontend := info["defaultfrontend"]; frontend != "" && frontend != "default" {
+		machine.Frontend = Frontend(frontend)
+	}
+	if authType := info["vrdeauthtype"]; authType != "" {
+		machine.VRDE.AuthType = VRDEAuthType(authType)
+	}
+	if machine.VRDEEnabled {
+		// vrdeport is -1 unless the machine is running
+		machine.VRDEPort, _ = parseVRDEPorts(info["vrdeports"])
+	}
+	if machine.CPUs == 0 {
+		machine.CPUs = 1
+	}
+	if machine.CPUCap == 0 {
+		machine.CPUCap = 100
+	}
+	machine.Groups = parseInfoGroups(info)
+	if hardwareUUID := info["hardwareuuid"]; hardwareUUID != "" {
+		machine.HardwareUUID, err = uuid.ParseHex(hardwareUUID)
+		if err != nil {
+			return nil, err
+		}
+		if *machine.HardwareUUID == machine.UUID {
+			machine.HardwareUUID = nil
+		}
+	}
+
+	for index := 1; ; index++ {
+		suffix := strconv.Itoa(index)
+		name, found := info["SharedFolderNameMachineMapping"+suffix]
+		if !found {
+			break
+		}
+		// writable and automount are only printed in the human readable form
+		machine.SharedFolders = append(machine.SharedFolders, SharedFolder{
+			Name:     name,
+			HostPath: info["SharedFolderPathMachineMapping"+suffix],
+		})
+	}
+
+	err = machine.parseInfoAdapters(text, info)
+	if err != nil {
+		return nil, err
+	}
+	err = machine.parseInfoStorage(info, disks)
+	if err != nil {
+		return nil, err
+	}
+	err = machine.parseInfoSnapshots(info, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if current := info["CurrentSnapshotUUID"]; current != "" {
+		machine.CurrentSnapshot, err = uuid.ParseHex(current)
+		if err != nil {
+			return nil, err
+		}
+	}
+	machine.refreshHardDisks()
+	return machine, nil
+}
+
+// Split the comma separated groups of the machine.
+func parseInfoGroups(info map[string]string) []string {
+	var groups []string
+	for _, group := range strings.Split(info["groups"], ",") {
+		if group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// Build the network adapters. The Forwarding(n) lines are numbered across
+// all adapters and follow the nicN line of the adapter they belong to, so
+// they are matched up in the order of the output.
+func (machine *Machine) parseInfoAdapters(text string, info map[string]string) error {
+	var adapter *NetworkAdapter
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := splitMachineReadable(line)
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(key, "nic") {
+			slot, err := strconv.Atoi(key[len("nic"):])
+			if err != nil {
+				continue
+			}
+			adapter = infoAdapter(info, slot, value)
+			machine.NetworkAdapters = append(machine.NetworkAdapters, adapter)
+			continue
+		}
+		if !strings.HasPrefix(key, "Forwarding(") || adapter == nil {
+			continue
+		}
+		fields := strings.Split(value, ",")
+		if len(fields) != 6 {
+			return fmt.Errorf("virtualbox: invalid forwarding rule %q", value)
+		}
+		forward := PortForward{
+			Name:     fields[0],
+			Protocol: Protocol(fields[1]),
+			HostIP:   fields[2],
+			GuestIP:  fields[4],
+		}
+		var err error
+		forward.HostPort, err = ParsePort(fields[3])
+		if err != nil {
+			return err
+		}
+		forward.GuestPort, err = ParsePort(fields[5])
+		if err != nil {
+			return err
+		}
+		if forward.Name == "selenium" {
+			machine.SeleniumPort = forward.HostPort
+		}
+		adapter.Forwards = append(adapter.Forwards, forward)
+		machine.Forwards = append(machine.Forwards, forward)
+	}
+	return nil
+}
+
+// Build the adapter in the slot from its nicN mode and the settings of that
+// mode.
+func infoAdapter(info map[string]string, slot int, mode string) *NetworkAdapter {
+	suffix := strconv.Itoa(slot)
+	adapter := &NetworkAdapter{
+		Slot:           slot,
+		Enabled:        mode != "none",
+		Mode:           NetworkMode(mode),
+		Type:           info["nictype"+suffix],
+		MACAddress:     info["macaddress"+suffix],
+		CableConnected: machineReadableFlag(info["cableconnected"+suffix]),
+	}
+	switch adapter.Mode {
+	case "none", "null":
+		adapter.Mode = NetworkNone
+	case NetworkNATNetwork:
+		adapter.NATNetwork = info["nat-network"+suffix]
+	case NetworkBridged:
+		adapter.BridgedInterface = info["bridgeadapter"+suffix]
+	case NetworkInternal:
+		adapter.InternalNetwork = info["intnet"+suffix]
+	case NetworkHostOnly:
+		adapter.HostOnlyInterface = info["hostonlyadapter"+suffix]
+	case NetworkGeneric:
+		adapter.GenericDriver = info["generic"+suffix]
+	}
+	return adapter
+}
+
+// Build the storage controllers from the storagecontroller*N values and
+// the "<controller>-<port>-<device>" attachments.
+func (machine *Machine) parseInfoStorage(info map[string]string, disks HardDiskMap) error {
+	for index := 0; ; index++ {
+		suffix := strconv.Itoa(index)
+		name, found := info["storagecontrollername"+suffix]
+		if !found {
+			return nil
+		}
+		controller := &StorageController{
+			Name:      name,
+			Type:      info["storagecontrollertype"+suffix],
+			PortCount: machineReadableInt(info["storagecontrollerportcount"+suffix]),
+			Bootable:  machineReadableFlag(info["storagecontrollerbootable"+suffix]),
+		}
+		for port := 0; port < controller.PortCount; port++ {
+			for device := 0; device < 2; device++ {
+				position := fmt.Sprintf("%d-%d", port, device)
+				location := info[name+"-"+position]
+				if location == "" || location == "none" {
+					continue
+				}
+				attached := AttachedDevice{Type: "DVD", Port: port, Device: device}
+				if imageUUID := info[name+"-ImageUUID-"+position]; imageUUID != "" {
+					medium, err := uuid.ParseHex(imageUUID)
+					if err != nil {
+						return err
+					}
+					attached.Medium = medium
+					if disks[*medium] != nil {
+						attached.Type = "HardDisk"
+					}
+				}
+				if controller.Type == "I82078" {
+					attached.Type = "Floppy"
+				}
+				controller.Devices = append(controller.Devices, attached)
+			}
+		}
+		machine.StorageControllers = append(machine.StorageControllers, controller)
+	}
+}
+
+// Flatten the snapshot tree printed as SnapshotName, SnapshotName-1,
+// SnapshotName-1-1 and so on, parents before their children.
+func (machine *Machine) parseInfoSnapshots(info map[string]string, suffix string, parent *Snapshot) error {
+	name, found := info["SnapshotName"+suffix]
+	if !found {
+		return nil
+	}
+	snapshotUUID, err := uuid.ParseHex(info["SnapshotUUID"+suffix])
+	if err != nil {
+		return err
+	}
+	snapshot := &Snapshot{
+		UUID:        *snapshotUUID,
+		Name:        name,
+		Description: info["SnapshotDescription"+suffix],
+	}
+	if parent != nil {
+		snapshot.Parent = &parent.UUID
+		parent.Children = append(parent.Children, &snapshot.UUID)
+	}
+	machine.Snapshots = append(machine.Snapshots, snapshot)
+	for child := 1; ; child++ {
+		childSuffix := suffix + "-" + strconv.Itoa(child)
+		if _, found := info["SnapshotName"+childSuffix]; !found {
+			return nil
+		}
+		err = machine.parseInfoSnapshots(info, childSuffix, snapshot)
+		if err != nil {
+			return err
+		}
+	}
+}
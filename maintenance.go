@@ -0,0 +1,107 @@
+package virtualbox
+
+import (
+	"context"
+	"time"
+)
+
+// Periodically reclaims disk space: running machines with Guest Additions
+// get fstrim run inside them through guest control, so that with discard
+// enabled the freed blocks are released by the image, and the VDI images of
+// machines that are off are compacted unless other machines use them.
+type Maintenance struct {
+	VirtualBox *VirtualBox
+	Interval   time.Duration
+
+	// Credentials of an account permitted to run fstrim in the machine.
+	// Machines without credentials are only compacted.
+	Credentials func(machine *Machine) (GuestCredentials, bool)
+
+	OnError func(machine *Machine, err error) // optional
+}
+
+// Path of fstrim inside Linux guests.
+var FstrimPath = "/sbin/fstrim"
+
+func (maintenance *Maintenance) reportError(machine *Machine, err error) {
+	if err != nil && maintenance.OnError != nil {
+		maintenance.OnError(machine, err)
+	}
+}
+
+// Run a single maintenance pass over all machines.
+func (maintenance *Maintenance) RunOnce(ctx context.Context) {
+	vbox := maintenance.VirtualBox
+	vbox.mutex.RLock()
+	machines := make([]*Machine, 0, len(vbox.Machines))
+	for _, machine := range vbox.Machines {
+		machines = append(machines, machine)
+	}
+	vbox.mutex.RUnlock()
+
+	for _, machine := range machines {
+		if ctx.Err() != nil {
+			return
+		}
+		status, err := machine.queryStatus()
+		if err != nil {
+			maintenance.reportError(machine, err)
+			continue
+		}
+		machine.Status = status
+
+		switch status {
+		case Running:
+			if maintenance.Credentials == nil {
+				continue
+			}
+			creds, ok := maintenance.Credentials(machine)
+			if !ok {
+				continue
+			}
+			_, err = machine.guestRun(ctx, creds, FstrimPath, "--all", "--verbose")
+			maintenance.reportError(machine, err)
+		case Off, Aborted:
+			for _, disk := range vbox.compactableHardDisks(machine) {
+				maintenance.reportError(machine, disk.CompactContext(ctx))
+			}
+		}
+	}
+}
+
+// Get the VDI images of the machine to compact: its attached disks and their
+// parents, leaving out those other machines use, such as the base image of
+// linked clones.
+func (vbox *VirtualBox) compactableHardDisks(machine *Machine) []*HardDisk {
+	vbox.mutex.RLock()
+	defer vbox.mutex.RUnlock()
+	exclusive := vbox.exclusiveHardDisks(machine)
+	var disks []*HardDisk
+	for _, attached := range machine.HardDisks {
+		for disk := vbox.HardDisks[*attached]; disk != nil && exclusive[disk.UUID]; {
+			delete(exclusive, disk.UUID)
+			if disk.Format == VDI {
+				disks = append(disks, disk)
+			}
+			if disk.Parent == nil {
+				break
+			}
+			disk = vbox.HardDisks[*disk.Parent]
+		}
+	}
+	return disks
+}
+
+// Run maintenance passes every Interval until the context is done.
+func (maintenance *Maintenance) Run(ctx context.Context) error {
+	ticker := time.NewTicker(maintenance.Interval)
+	defer ticker.Stop()
+	for {
+		maintenance.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
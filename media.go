@@ -0,0 +1,162 @@
+package virtualbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// An optical disc image, such as an installer ISO.
+type DVDImage struct {
+	UUID     uuid.UUID
+	Location string
+}
+
+// A floppy disk image.
+type FloppyImage struct {
+	UUID     uuid.UUID
+	Location string
+}
+
+type DVDImageMap map[uuid.UUID]*DVDImage
+type FloppyImageMap map[uuid.UUID]*FloppyImage
+
+type xmlImage struct {
+	UUID     string `xml:"uuid,attr"`
+	Location string `xml:"location,attr"`
+}
+
+// The media registry of VirtualBox.xml or of a machine settings file. Since
+// VirtualBox 4.0 media are registered in the settings file of the first
+// machine they are attached to, while VirtualBox.xml keeps the others and
+// those registered by older versions.
+type xmlMediaRegistry struct {
+	HardDisks    []xmlHardDisk `xml:"HardDisks>HardDisk"`
+	DVDImages    []xmlImage    `xml:"DVDImages>Image"`
+	FloppyImages []xmlImage    `xml:"FloppyImages>Image"`
+}
+
+// Parse the UUID of the image and resolve its location relative to dir.
+func (image *xmlImage) parse(dir string) (*uuid.UUID, string, error) {
+	imageUUID, err := uuid.ParseHex(image.UUID)
+	if err != nil {
+		return nil, "", err
+	}
+	location := image.Location
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(dir, location)
+	}
+	return imageUUID, location, nil
+}
+
+// The media of a registry.
+type registeredMedia struct {
+	hardDisks    HardDiskMap
+	dvdImages    DVDImageMap
+	floppyImages FloppyImageMap
+}
+
+// Get the media of the registry, with locations relative to dir.
+func (registry *xmlMediaRegistry) media(dir string) (*registeredMedia, error) {
+	media := &registeredMedia{
+		hardDisks:    make(HardDiskMap),
+		dvdImages:    make(DVDImageMap, len(registry.DVDImages)),
+		floppyImages: make(FloppyImageMap, len(registry.FloppyImages)),
+	}
+	for index := range registry.HardDisks {
+		_, err := media.hardDisks.AddHardDisks(&registry.HardDisks[index], nil, dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, image := range registry.DVDImages {
+		imageUUID, location, err := image.parse(dir)
+		if err != nil {
+			return nil, err
+		}
+		media.dvdImages[*imageUUID] = &DVDImage{UUID: *imageUUID, Location: location}
+	}
+	for _, image := range registry.FloppyImages {
+		imageUUID, location, err := image.parse(dir)
+		if err != nil {
+			return nil, err
+		}
+		media.floppyImages[*imageUUID] = &FloppyImage{UUID: *imageUUID, Location: location}
+	}
+	return media, nil
+}
+
+// Add the media of a registry to the maps, recording the conflicting disks
+// like mergeHardDisks.
+func (vbox *VirtualBox) mergeMedia(media *registeredMedia) {
+	if vbox.HardDisks == nil {
+		vbox.HardDisks = make(HardDiskMap)
+	}
+	if vbox.DVDImages == nil {
+		vbox.DVDImages = make(DVDImageMap)
+	}
+	if vbox.FloppyImages == nil {
+		vbox.FloppyImages = make(FloppyImageMap)
+	}
+	vbox.mergeHardDisks(media.hardDisks)
+	for imageUUID, image := range media.dvdImages {
+		vbox.DVDImages[imageUUID] = image
+	}
+	for imageUUID, image := range media.floppyImages {
+		vbox.FloppyImages[imageUUID] = image
+	}
+}
+
+func (images DVDImageMap) MarshalJSON() ([]byte, error) {
+	imagesStrings := make(map[string]*DVDImage, len(images))
+	for uuid, image := range images {
+		imagesStrings[uuid.String()] = image
+	}
+	return json.Marshal(imagesStrings)
+}
+
+// Load the images from the JSON written by MarshalJSON.
+func (images *DVDImageMap) UnmarshalJSON(data []byte) error {
+	var imagesStrings map[string]*DVDImage
+	err := json.Unmarshal(data, &imagesStrings)
+	if err != nil {
+		return err
+	}
+	*images = make(DVDImageMap, len(imagesStrings))
+	for uuidString, image := range imagesStrings {
+		imageUUID, err := uuid.ParseHex(uuidString)
+		if err != nil {
+			return fmt.Errorf("virtualbox: invalid DVD image UUID %q", uuidString)
+		}
+		(*images)[*imageUUID] = image
+	}
+	return nil
+}
+
+func (images FloppyImageMap) MarshalJSON() ([]byte, error) {
+	imagesStrings := make(map[string]*FloppyImage, len(images))
+	for uuid, image := range images {
+		imagesStrings[uuid.String()] = image
+	}
+	return json.Marshal(imagesStrings)
+}
+
+// Load the images from the JSON written by MarshalJSON.
+func (images *FloppyImageMap) UnmarshalJSON(data []byte) error {
+	var imagesStrings map[string]*FloppyImage
+	err := json.Unmarshal(data, &imagesStrings)
+	if err != nil {
+		return err
+	}
+	*images = make(FloppyImageMap, len(imagesStrings))
+	for uuidString, image := range imagesStrings {
+		imageUUID, err := uuid.ParseHex(uuidString)
+		if err != nil {
+			return fmt.Errorf("virtualbox: invalid floppy image UUID %q", uuidString)
+		}
+		(*images)[*imageUUID] = image
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package virtualbox
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// A metric of a machine, or of the host, reported by "metrics query".
+type metricValue struct {
+	Object string // the machine name, or host
+	Metric string
+	Values []float64 // oldest first, in Unit
+	Unit   string
+}
+
+var (
+	metricsLine   = regexp.MustCompile(`^(.*?)\s+([A-Za-z]+/[A-Za-z/]+(?::[a-z]+)?)\s+(\S.*)$`)
+	metricsSample = regexp.MustCompile(`^(-?[\d.]+)\s*(\S*)$`)
+)
+
+// Parse the table printed by "metrics query".
+func parseMetrics(output string) []metricValue {
+	var values []metricValue
+	for _, line := range strings.Split(output, "\n") {
+		match := metricsLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if match == nil || match[1] == "Object" || strings.HasPrefix(match[1], "---") {
+			continue
+		}
+		value := metricValue{Object: match[1], Metric: match[2]}
+		for _, sample := range strings.Split(match[3], ",") {
+			sampleMatch := metricsSample.FindStringSubmatch(strings.TrimSpace(sample))
+			if sampleMatch == nil {
+				continue
+			}
+			number, err := strconv.ParseFloat(sampleMatch[1], 64)
+			if err != nil {
+				continue
+			}
+			value.Values = append(value.Values, number)
+			value.Unit = sampleMatch[2]
+		}
+		if len(value.Values) != 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Collects VBoxManage metrics of the running machines, enabling collection
+// again when machines start since VirtualBox only collects metrics of the
+// machines running at setup.
+type metricsCollector struct {
+	metrics []string
+	period  time.Duration
+	running map[uuid.UUID]bool
+}
+
+// Get the latest values of the metrics.
+func (collector *metricsCollector) query(ctx context.Context) ([]metricValue, error) {
+	running, err := runningMachines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for machineUUID := range running {
+		if !collector.running[machineUUID] {
+			collector.running = nil
+			break
+		}
+	}
+	names := strings.Join(collector.metrics, ",")
+	if collector.running == nil {
+		seconds := int(collector.period / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		_, err = vboxManageContext(ctx, "metrics", "setup",
+			"--period", strconv.Itoa(seconds), "--samples", "1", "*", names)
+		if err != nil {
+			return nil, err
+		}
+		collector.running = running
+	}
+	bytes, err := vboxManageContext(ctx, "metrics", "query", "*", names)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetrics(string(bytes)), nil
+}
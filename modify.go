@@ -0,0 +1,165 @@
+package virtualbox
+
+import (
+	"strconv"
+)
+
+// The most capable USB controller of a machine.
+type USBController string
+
+const (
+	USBNone = USBController("")
+	USBOHCI = USBController("ohci") // USB 1.1
+	USBEHCI = USBController("ehci") // USB 2.0, along with OHCI
+	USBXHCI = USBController("xhci") // USB 3.0
+)
+
+type xmlDisplay struct {
+	VRAMSize int `xml:"VRAMSize,attr"` // megabytes
+}
+
+type xmlUSBController struct {
+	Type string `xml:"type,attr"`
+}
+
+// CPU settings found in Hardware>CPU before VirtualBox 7.1 and in
+// Platform>x86>CPU after. Nested paging defaults to on.
+type xmlCPUFeatures struct {
+	PAE          xmlEnabled `xml:"PAE"`
+	NestedPaging xmlFlag    `xml:"HardwareVirtExNestedPaging"`
+}
+
+type xmlFlag struct {
+	Enabled string `xml:"enabled,attr"`
+}
+
+// Apply the settings Modify changes that are not decoded elsewhere.
+func (hardware *xmlHardware) applyModifiable(machine *Machine) {
+	machine.VRAM = hardware.Display.VRAMSize
+	machine.PAE = hardware.CPU.PAE.Enabled || hardware.Platform.CPU.PAE.Enabled
+	machine.NestedPaging = hardware.CPU.NestedPaging.Enabled != "false" &&
+		hardware.Platform.CPU.NestedPaging.Enabled != "false"
+	machine.USB = USBNone
+	for _, controller := range hardware.USBControllers {
+		switch controller.Type {
+		case "XHCI":
+			machine.USB = USBXHCI
+		case "EHCI":
+			if machine.USB != USBXHCI {
+				machine.USB = USBEHCI
+			}
+		case "OHCI":
+			if machine.USB == USBNone {
+				machine.USB = USBOHCI
+			}
+		}
+	}
+}
+
+// Hardware settings changed together by Machine.Modify.
+type ModifyVM struct {
+	Memory       int // megabytes
+	CPUs         int
+	VRAM         int // megabytes
+	Firmware     Firmware
+	BootOrder    []BootDevice
+	NestedPaging bool
+	PAE          bool
+	RTCUseUTC    bool
+	Audio        bool // play sound on the host
+	USB          USBController
+}
+
+// Get the current values of the settings Modify changes, as decoded.
+func (machine *Machine) CurrentSettings() ModifyVM {
+	return ModifyVM{
+		Memory:       machine.Memory,
+		CPUs:         machine.CPUs,
+		VRAM:         machine.VRAM,
+		Firmware:     machine.Firmware,
+		BootOrder:    append([]BootDevice(nil), machine.BootOrder...),
+		NestedPaging: machine.NestedPaging,
+		PAE:          machine.PAE,
+		RTCUseUTC:    machine.RTCUseUTC,
+		Audio:        machine.Audio,
+		USB:          machine.USB,
+	}
+}
+
+func sameBootOrder(a, b []BootDevice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if a[index] != b[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// Change the settings that differ from the current ones with a single
+// modifyvm. Start from CurrentSettings to change only some of them: if the
+// settings file was changed by someone else since decoding, nothing is
+// changed and ErrConcurrentModification is returned.
+func (machine *Machine) Modify(settings ModifyVM) error {
+	current := machine.CurrentSettings()
+	var args []string
+	if settings.Memory != current.Memory {
+		args = append(args, "--memory", strconv.Itoa(settings.Memory))
+	}
+	if settings.CPUs != current.CPUs {
+		args = append(args, "--cpus", strconv.Itoa(settings.CPUs))
+	}
+	if settings.VRAM != current.VRAM {
+		args = append(args, "--vram", strconv.Itoa(settings.VRAM))
+	}
+	if settings.Firmware != current.Firmware {
+		args = append(args, "--firmware", string(settings.Firmware))
+	}
+	if !sameBootOrder(settings.BootOrder, current.BootOrder) {
+		bootArgs, err := bootOrderArgs(settings.BootOrder)
+		if err != nil {
+			return err
+		}
+		args = append(args, bootArgs...)
+	}
+	if settings.NestedPaging != current.NestedPaging {
+		args = append(args, "--nestedpaging", onOff(settings.NestedPaging))
+	}
+	if settings.PAE != current.PAE {
+		args = append(args, "--pae", onOff(settings.PAE))
+	}
+	if settings.RTCUseUTC != current.RTCUseUTC {
+		args = append(args, "--rtcuseutc", onOff(settings.RTCUseUTC))
+	}
+	if settings.Audio != current.Audio {
+		args = append(args, "--audio-enabled", onOff(settings.Audio),
+			"--audio-out", onOff(settings.Audio))
+	}
+	if settings.USB != current.USB {
+		args = append(args,
+			"--usbohci", onOff(settings.USB == USBOHCI || settings.USB == USBEHCI),
+			"--usbehci", onOff(settings.USB == USBEHCI),
+			"--usbxhci", onOff(settings.USB == USBXHCI))
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	err := machine.modifyVM(args...)
+	if err != nil {
+		return err
+	}
+
+	machine.Memory = settings.Memory
+	machine.CPUs = settings.CPUs
+	machine.VRAM = settings.VRAM
+	machine.Firmware = settings.Firmware
+	machine.setBootOrder(settings.BootOrder)
+	machine.NestedPaging = settings.NestedPaging
+	machine.PAE = settings.PAE
+	machine.RTCUseUTC = settings.RTCUseUTC
+	machine.Audio = settings.Audio
+	machine.USB = settings.USB
+	return nil
+}
@@ -0,0 +1,63 @@
+package virtualbox
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Longest machine name accepted, since the name is also used for the
+// machine folder and settings file name.
+const MaxMachineNameLength = 255
+
+var (
+	ErrEmptyMachineName   = errors.New("virtualbox: machine name is empty")
+	ErrInvalidMachineName = errors.New("virtualbox: machine name is not valid")
+)
+
+// Check the name is acceptable to VirtualBox. The name is used for the
+// machine folder and settings file, so it must not be empty, padded with
+// whitespace, contain path separators or control characters, or be a
+// relative path component.
+func ValidateMachineName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrEmptyMachineName
+	}
+	if strings.TrimSpace(name) != name || len(name) > MaxMachineNameLength ||
+		name == "." || name == ".." {
+		return ErrInvalidMachineName
+	}
+	for _, r := range name {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return ErrInvalidMachineName
+		}
+	}
+	return nil
+}
+
+// Check if a machine with the given name exists, ignoring case since the
+// settings folders of machines differing only by case collide on case
+// insensitive file systems.
+func (vbox *VirtualBox) nameInUse(name string) bool {
+	for _, machine := range vbox.Machines {
+		if strings.EqualFold(machine.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate a machine name of the form "prefix-N" not used by any machine.
+func (vbox *VirtualBox) GenerateName(prefix string) (string, error) {
+	err := ValidateMachineName(prefix)
+	if err != nil {
+		return "", err
+	}
+	for n := 1; ; n++ {
+		name := prefix + "-" + strconv.Itoa(n)
+		if !vbox.nameInUse(name) {
+			return name, nil
+		}
+	}
+}
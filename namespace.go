@@ -0,0 +1,120 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Returned by operations on machines outside the configured namespace.
+var ErrOutsideNamespace = errors.New("virtualbox: machine is outside the namespace")
+
+// When non-empty, only machines whose names start with NamespacePrefix, or
+// that belong to NamespaceGroup or one of its subgroups, are decoded and can
+// be operated on, and new machines must be named with the prefix. This lets
+// independent tools share a host without touching each other's machines.
+var (
+	NamespacePrefix string
+	NamespaceGroup  string
+)
+
+// Check if a machine with the given name and groups is in the namespace.
+func inNamespace(name string, groups []string) bool {
+	if NamespacePrefix == "" && NamespaceGroup == "" {
+		return true
+	}
+	if NamespacePrefix != "" && strings.HasPrefix(name, NamespacePrefix) {
+		return true
+	}
+	return NamespaceGroup != "" && inGroup(groups, NamespaceGroup)
+}
+
+// Check if a machine belongs to the group or one of its subgroups.
+func inGroup(groups []string, group string) bool {
+	group = strings.TrimSuffix(group, "/")
+	for _, machineGroup := range groups {
+		if machineGroup == group || strings.HasPrefix(machineGroup, group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a machine belongs to the group itself, not only a subgroup.
+func inExactGroup(groups []string, group string) bool {
+	group = strings.TrimSuffix(group, "/")
+	for _, machineGroup := range groups {
+		if machineGroup == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the machine is in the namespace.
+func (machine *Machine) InNamespace() bool {
+	return inNamespace(machine.Name, machine.Groups)
+}
+
+func (machine *Machine) checkNamespace() error {
+	if !machine.InNamespace() {
+		return ErrOutsideNamespace
+	}
+	return nil
+}
+
+// The VBoxManage commands that change the machine settings, which fail with
+// ErrConcurrentModification when someone else changed them since decoding.
+// Other commands, such as controlvm and guestproperty, only change the
+// running machine, even if VirtualBox records that in the settings file.
+var settingsCommands = map[string]bool{
+	"modifyvm":      true,
+	"storagectl":    true,
+	"storageattach": true,
+	"sharedfolder":  true,
+	"setextradata":  true,
+	"snapshot":      true,
+	"discardstate":  true,
+	"unattended":    true,
+}
+
+// Run a VBoxManage command that changes the machine, after any other one
+// changing it has finished. Settings commands fail with
+// ErrConcurrentModification instead if the settings were changed by someone
+// else since decoding. The changes VirtualBox makes to the settings file
+// for any command are taken as ours, unless it had already been changed by
+// someone else.
+func (machine *Machine) manage(ctx context.Context, args ...string) ([]byte, error) {
+	defer InvalidateStatusCache()
+	return machine.manageWith(ctx, vboxManageModifyContext, args...)
+}
+
+// Run a medium heavy VBoxManage command that changes the machine like
+// manage.
+func (machine *Machine) manageMedium(ctx context.Context, args ...string) ([]byte, error) {
+	return machine.manageWith(ctx, vboxManageMediumContext, args...)
+}
+
+func (machine *Machine) manageWith(ctx context.Context, run func(context.Context, ...string) ([]byte, error), args ...string) ([]byte, error) {
+	err := machine.checkNamespace()
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockMachine(ctx, machine.UUID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	unmodified := machine.checkUnmodified()
+	if len(args) != 0 && settingsCommands[args[0]] && unmodified != nil {
+		return nil, unmodified
+	}
+	bytes, err := run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	if unmodified == nil {
+		machine.refreshFingerprint()
+	}
+	return bytes, nil
+}
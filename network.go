@@ -0,0 +1,164 @@
+package virtualbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// How a network adapter is attached, named as in --nic.
+type NetworkMode string
+
+const (
+	NetworkNone       = NetworkMode("none")
+	NetworkNAT        = NetworkMode("nat")
+	NetworkNATNetwork = NetworkMode("natnetwork")
+	NetworkBridged    = NetworkMode("bridged")
+	NetworkInternal   = NetworkMode("intnet")
+	NetworkHostOnly   = NetworkMode("hostonly")
+	NetworkGeneric    = NetworkMode("generic")
+)
+
+type NetworkAdapter struct {
+	Slot              int // starting at 1, as in --nic1
+	Enabled           bool
+	Mode              NetworkMode
+	Type              string        `json:",omitempty"` // emulated hardware, such as 82540EM or virtio
+	MACAddress        string        `json:",omitempty"`
+	CableConnected    bool          `json:",omitempty"`
+	HostOnlyInterface string        `json:",omitempty"`
+	BridgedInterface  string        `json:",omitempty"`
+	InternalNetwork   string        `json:",omitempty"`
+	NATNetwork        string        `json:",omitempty"`
+	GenericDriver     string        `json:",omitempty"`
+	Forwards          []PortForward `json:",omitempty"`
+}
+
+type xmlNAT struct {
+	Forwarding []xmlNetworkForwarding `xml:"Forwarding"`
+}
+
+type xmlNamedAttachment struct {
+	Name string `xml:"name,attr"`
+}
+
+type xmlGenericAttachment struct {
+	Driver string `xml:"driver,attr"`
+}
+
+// Only the settings of the current mode are direct children of the adapter,
+// the others are kept in DisabledModes.
+type xmlNetworkAdapter struct {
+	Slot              int                   `xml:"slot,attr"`
+	Enabled           bool                  `xml:"enabled,attr"`
+	Type              string                `xml:"type,attr"`
+	MACAddress        string                `xml:"MACAddress,attr"`
+	Cable             string                `xml:"cable,attr"`
+	NAT               *xmlNAT               `xml:"NAT"`
+	NATNetwork        *xmlNamedAttachment   `xml:"NATNetwork"`
+	BridgedInterface  *xmlNamedAttachment   `xml:"BridgedInterface"`
+	InternalNetwork   *xmlNamedAttachment   `xml:"InternalNetwork"`
+	HostOnlyInterface *xmlNamedAttachment   `xml:"HostOnlyInterface"`
+	GenericInterface  *xmlGenericAttachment `xml:"GenericInterface"`
+}
+
+func (xmlAdapter *xmlNetworkAdapter) adapter() *NetworkAdapter {
+	adapter := &NetworkAdapter{
+		Slot:           xmlAdapter.Slot + 1,
+		Enabled:        xmlAdapter.Enabled,
+		Mode:           NetworkNone,
+		Type:           xmlAdapter.Type,
+		MACAddress:     xmlAdapter.MACAddress,
+		CableConnected: !strings.EqualFold(xmlAdapter.Cable, "false"),
+	}
+	switch {
+	case xmlAdapter.NAT != nil:
+		adapter.Mode = NetworkNAT
+		for _, forwarding := range xmlAdapter.NAT.Forwarding {
+			adapter.Forwards = append(adapter.Forwards, forwarding.forward())
+		}
+	case xmlAdapter.NATNetwork != nil:
+		adapter.Mode = NetworkNATNetwork
+		adapter.NATNetwork = xmlAdapter.NATNetwork.Name
+	case xmlAdapter.BridgedInterface != nil:
+		adapter.Mode = NetworkBridged
+		adapter.BridgedInterface = xmlAdapter.BridgedInterface.Name
+	case xmlAdapter.InternalNetwork != nil:
+		adapter.Mode = NetworkInternal
+		adapter.InternalNetwork = xmlAdapter.InternalNetwork.Name
+	case xmlAdapter.HostOnlyInterface != nil:
+		adapter.Mode = NetworkHostOnly
+		adapter.HostOnlyInterface = xmlAdapter.HostOnlyInterface.Name
+	case xmlAdapter.GenericInterface != nil:
+		adapter.Mode = NetworkGeneric
+		adapter.GenericDriver = xmlAdapter.GenericInterface.Driver
+	}
+	return adapter
+}
+
+// Get the network adapter in the slot, starting at 1.
+func (machine *Machine) NetworkAdapter(slot int) *NetworkAdapter {
+	for _, adapter := range machine.NetworkAdapters {
+		if adapter.Slot == slot {
+			return adapter
+		}
+	}
+	return nil
+}
+
+// Attach the network adapter in adapter.Slot to its Mode and network, and
+// set its Type and MACAddress if given. Forwards are left alone, use
+// AddPortForward for those. The machine must be off.
+func (machine *Machine) SetNetworkAdapter(adapter NetworkAdapter) error {
+	if adapter.Slot < 1 {
+		return fmt.Errorf("virtualbox: invalid network adapter slot %d", adapter.Slot)
+	}
+	if adapter.Mode == "" {
+		adapter.Mode = NetworkNone
+	}
+	slot := strconv.Itoa(adapter.Slot)
+	args := []string{"--nic" + slot, string(adapter.Mode)}
+	switch adapter.Mode {
+	case NetworkBridged:
+		args = append(args, "--bridgeadapter"+slot, adapter.BridgedInterface)
+	case NetworkHostOnly:
+		args = append(args, "--hostonlyadapter"+slot, adapter.HostOnlyInterface)
+	case NetworkInternal:
+		args = append(args, "--intnet"+slot, adapter.InternalNetwork)
+	case NetworkNATNetwork:
+		args = append(args, "--nat-network"+slot, adapter.NATNetwork)
+	case NetworkGeneric:
+		args = append(args, "--nicgenericdrv"+slot, adapter.GenericDriver)
+	}
+	if adapter.Type != "" {
+		args = append(args, "--nictype"+slot, adapter.Type)
+	}
+	if adapter.MACAddress != "" {
+		args = append(args, "--macaddress"+slot, adapter.MACAddress)
+	}
+	err := machine.modifyVM(args...)
+	if err != nil {
+		return err
+	}
+
+	adapter.Enabled = adapter.Mode != NetworkNone
+	adapter.Forwards = nil
+	if adapter.Slot == 1 && adapter.Mode != NetworkNAT {
+		machine.Forwards = nil
+	}
+	if existing := machine.NetworkAdapter(adapter.Slot); existing != nil {
+		if existing.Mode == NetworkNAT && adapter.Mode == NetworkNAT {
+			adapter.Forwards = existing.Forwards
+		}
+		if adapter.Type == "" {
+			adapter.Type = existing.Type
+		}
+		if adapter.MACAddress == "" {
+			adapter.MACAddress = existing.MACAddress
+		}
+		*existing = adapter
+	} else {
+		machine.NetworkAdapters = append(machine.NetworkAdapters, &adapter)
+	}
+	return nil
+}
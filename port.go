@@ -0,0 +1,104 @@
+package virtualbox
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+)
+
+// A TCP or UDP port number.
+type Port int
+
+const (
+	MinPort           = Port(1)
+	MaxPort           = Port(65535)
+	MaxPrivilegedPort = Port(1023)
+)
+
+type InvalidPortError struct {
+	Port Port
+}
+
+func (e *InvalidPortError) Error() string {
+	return fmt.Sprintf("virtualbox: port %d is outside the range %d-%d",
+		int(e.Port), int(MinPort), int(MaxPort))
+}
+
+// Parse a port number, validating its range.
+func ParsePort(text string) (Port, error) {
+	number, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, err
+	}
+	port := Port(number)
+	return port, port.Validate()
+}
+
+// Check the port is within the valid range.
+func (port Port) Validate() error {
+	if port < MinPort || port > MaxPort {
+		return &InvalidPortError{Port: port}
+	}
+	return nil
+}
+
+// Check if binding the port on the host requires elevated privileges.
+func (port Port) Privileged() bool {
+	return port >= MinPort && port <= MaxPrivilegedPort
+}
+
+func (port Port) String() string {
+	return strconv.Itoa(int(port))
+}
+
+// Validate a port about to be configured on the host, logging a warning if
+// it is privileged since VirtualBox usually runs unprivileged and will fail
+// to bind it.
+func (port Port) validateHost() error {
+	err := port.Validate()
+	if err != nil {
+		return err
+	}
+	if port.Privileged() {
+		log.Printf("virtualbox: port %d is privileged and may fail to bind", int(port))
+	}
+	return nil
+}
+
+// Check if the port can currently be bound on all host interfaces.
+func (port Port) Available() bool {
+	listener, err := net.Listen("tcp", ":"+port.String())
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// Get a port the operating system considers free on the host.
+func FreePort() (Port, error) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return Port(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// Get the first available port in the inclusive range, skipping any in the
+// exclude set, such as ports already assigned to machines that are off.
+func FreePortInRange(min, max Port, exclude map[Port]bool) (Port, error) {
+	if err := min.Validate(); err != nil {
+		return 0, err
+	}
+	if err := max.Validate(); err != nil {
+		return 0, err
+	}
+	for port := min; port <= max; port++ {
+		if !exclude[port] && port.Available() {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("virtualbox: no free port in range %d-%d", int(min), int(max))
+}
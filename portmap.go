@@ -0,0 +1,76 @@
+package virtualbox
+
+import (
+	uuid "github.com/daaku/gouuid"
+)
+
+const (
+	PortPurposeVRDE    = "vrde"
+	PortPurposeForward = "forward"
+)
+
+// A host port used by a machine.
+type PortUse struct {
+	Port        Port
+	Protocol    Protocol
+	Machine     uuid.UUID
+	MachineName string
+	Purpose     string
+	Name        string `json:",omitempty"` // forwarding rule name
+	HostIP      string `json:",omitempty"` // the address bound, empty for all interfaces
+}
+
+// Get every host port configured for VRDE or NAT forwarding across all
+// machines, keyed by port. Ports with more than one use are conflicts
+// unless the machines never run at the same time.
+func (vbox *VirtualBox) PortMap() map[Port][]PortUse {
+	ports := make(map[Port][]PortUse)
+	for _, machine := range vbox.Machines {
+		if machine.VRDEPort != 0 {
+			ports[machine.VRDEPort] = append(ports[machine.VRDEPort], PortUse{
+				Port:        machine.VRDEPort,
+				Protocol:    TCP,
+				Machine:     machine.UUID,
+				MachineName: machine.Name,
+				Purpose:     PortPurposeVRDE,
+				HostIP:      vrdeAddress(machine),
+			})
+		}
+		for _, forward := range machine.Forwards {
+			ports[forward.HostPort] = append(ports[forward.HostPort], PortUse{
+				Port:        forward.HostPort,
+				Protocol:    forward.Protocol,
+				Machine:     machine.UUID,
+				MachineName: machine.Name,
+				Purpose:     PortPurposeForward,
+				Name:        forward.Name,
+				HostIP:      forward.HostIP,
+			})
+		}
+	}
+	return ports
+}
+
+func vrdeAddress(machine *Machine) string {
+	if machine.VRDE == nil {
+		return ""
+	}
+	return machine.VRDE.Properties[VRDEAddressProperty]
+}
+
+// Get the ports used more than once for the same protocol.
+func (vbox *VirtualBox) PortConflicts() map[Port][]PortUse {
+	conflicts := make(map[Port][]PortUse)
+	for port, uses := range vbox.PortMap() {
+		count := make(map[Protocol]int)
+		for _, use := range uses {
+			count[use.Protocol]++
+		}
+		for _, use := range uses {
+			if count[use.Protocol] > 1 {
+				conflicts[port] = append(conflicts[port], use)
+			}
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,180 @@
+package virtualbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"regexp"
+	"runtime"
+)
+
+type PowerEvent int
+
+const (
+	HostSleep PowerEvent = iota
+	HostWake
+)
+
+// A source of host power events. The channel is closed when the context is
+// done or the source fails.
+type PowerEventSource interface {
+	PowerEvents(ctx context.Context) (<-chan PowerEvent, error)
+}
+
+// A PowerEventSource fed by the output of a long running command, where lines
+// matching Sleep or Wake trigger the respective events. A nil pattern never
+// matches.
+type CommandPowerEvents struct {
+	Command []string
+	Sleep   *regexp.Regexp
+	Wake    *regexp.Regexp
+}
+
+func (source *CommandPowerEvents) PowerEvents(ctx context.Context) (<-chan PowerEvent, error) {
+	if len(source.Command) == 0 {
+		return nil, errors.New("virtualbox: power events need a command")
+	}
+	cmd := newCommand(ctx, source.Command[0], source.Command[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan PowerEvent)
+	go func() {
+		defer close(events)
+		defer cmd.Wait()
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			var event PowerEvent
+			switch {
+			case source.Sleep != nil && source.Sleep.Match(line):
+				event = HostSleep
+			case source.Wake != nil && source.Wake.Match(line):
+				event = HostWake
+			default:
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Power events from the systemd-logind PrepareForSleep signal. Sleep is not
+// delayed, so pausing is more reliable than saving state with this source
+// unless a delay inhibitor is held by the caller.
+func LogindPowerEvents() PowerEventSource {
+	return &CommandPowerEvents{
+		Command: []string{
+			"dbus-monitor", "--system",
+			"type='signal',interface='org.freedesktop.login1.Manager',member='PrepareForSleep'",
+		},
+		Sleep: regexp.MustCompile(`^\s*boolean true`),
+		Wake:  regexp.MustCompile(`^\s*boolean false`),
+	}
+}
+
+// Power events from the macOS power management messages in the unified log.
+func MacOSPowerEvents() PowerEventSource {
+	return &CommandPowerEvents{
+		Command: []string{
+			"log", "stream", "--style", "syslog", "--predicate",
+			`eventMessage CONTAINS "Entering Sleep" OR eventMessage CONTAINS "Wake reason"`,
+		},
+		Sleep: regexp.MustCompile(`Entering Sleep`),
+		Wake:  regexp.MustCompile(`Wake reason`),
+	}
+}
+
+// Get the power event source for the current platform.
+func DefaultPowerEvents() (PowerEventSource, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return LogindPowerEvents(), nil
+	case "darwin":
+		return MacOSPowerEvents(), nil
+	}
+	return nil, errors.New("virtualbox: no power event source for " + runtime.GOOS)
+}
+
+type SleepAction int
+
+const (
+	SleepPause SleepAction = iota
+	SleepSaveState
+)
+
+// Suspends machines while the host sleeps and brings them back on wake, to
+// avoid guests with skewed clocks or wedged devices on laptops.
+type PowerHook struct {
+	Machines []*Machine
+	Action   SleepAction
+	Headless bool                              // start type used to restore saved machines
+	OnError  func(machine *Machine, err error) // optional
+	affected []*Machine
+}
+
+func (hook *PowerHook) reportError(machine *Machine, err error) {
+	if err != nil && hook.OnError != nil {
+		hook.OnError(machine, err)
+	}
+}
+
+// Suspend the running machines according to the configured action.
+func (hook *PowerHook) Sleep() {
+	hook.affected = hook.affected[:0]
+	for _, machine := range hook.Machines {
+		if machine.Status != Running {
+			continue
+		}
+		var err error
+		if hook.Action == SleepSaveState {
+			err = machine.SaveState()
+		} else {
+			err = machine.Pause()
+		}
+		hook.reportError(machine, err)
+		if err == nil {
+			hook.affected = append(hook.affected, machine)
+		}
+	}
+}
+
+// Bring back the machines suspended by the last Sleep.
+func (hook *PowerHook) Wake() {
+	for _, machine := range hook.affected {
+		if machine.Status == Paused {
+			hook.reportError(machine, machine.Resume())
+		} else {
+			hook.reportError(machine, machine.Start(hook.Headless))
+		}
+	}
+	hook.affected = hook.affected[:0]
+}
+
+// Handle events from the source until the context is done.
+func (hook *PowerHook) Run(ctx context.Context, source PowerEventSource) error {
+	events, err := source.PowerEvents(ctx)
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		switch event {
+		case HostSleep:
+			hook.Sleep()
+		case HostWake:
+			hook.Wake()
+		}
+	}
+	return ctx.Err()
+}
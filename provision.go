@@ -0,0 +1,299 @@
+package virtualbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Description of a machine to create.
+type MachineSpec struct {
+	Name       string
+	OSType     OSType
+	Memory     int           `json:",omitempty"`
+	CPUs       int           `json:",omitempty"`
+	BaseImage  string        `json:",omitempty"` // disk attached to the first SATA port
+	BaseFolder string        `json:",omitempty"`
+	Groups     []string      `json:",omitempty"`
+	Forwards   []PortForward `json:",omitempty"`
+}
+
+type ProvisionResult struct {
+	Spec MachineSpec
+	UUID *uuid.UUID `json:",omitempty"`
+	Err  error      `json:"-"`
+}
+
+type ProvisionReport struct {
+	Results []ProvisionResult
+}
+
+// Get the number of machines that failed to provision.
+func (report *ProvisionReport) Failed() (failed int) {
+	for _, result := range report.Results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return
+}
+
+func (report *ProvisionReport) String() string {
+	var buffer bytes.Buffer
+	for _, result := range report.Results {
+		if result.Err != nil {
+			fmt.Fprintf(&buffer, "FAIL %s: %s\n", result.Spec.Name, result.Err)
+		} else {
+			fmt.Fprintf(&buffer, "OK   %s: %s\n", result.Spec.Name, result.UUID)
+		}
+	}
+	fmt.Fprintf(&buffer, "%d created, %d failed\n",
+		len(report.Results)-report.Failed(), report.Failed())
+	return buffer.String()
+}
+
+// Create and register a machine according to the spec. A base image is
+// attached as is, so specs sharing one should use an immutable disk.
+func (spec *MachineSpec) Create() (*Machine, error) {
+	machine, err := CreateMachine{
+		Name:       spec.Name,
+		OSType:     spec.OSType,
+		Register:   true,
+		BaseFolder: spec.BaseFolder,
+		Groups:     spec.Groups,
+	}.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	var modify []string
+	if spec.Memory != 0 {
+		modify = append(modify, "--memory", strconv.Itoa(spec.Memory))
+	}
+	if spec.CPUs != 0 {
+		modify = append(modify, "--cpus", strconv.Itoa(spec.CPUs))
+	}
+	if len(spec.Forwards) != 0 {
+		modify = append(modify, "--nic1", "nat")
+	}
+	if len(modify) != 0 {
+		err = machine.modifyVM(modify...)
+		if err != nil {
+			return machine, err
+		}
+	}
+	if spec.Memory != 0 {
+		machine.Memory = spec.Memory
+	}
+	if spec.CPUs != 0 {
+		machine.CPUs = spec.CPUs
+	}
+
+	for _, forward := range spec.Forwards {
+		err = machine.AddPortForward(forward)
+		if err != nil {
+			return machine, err
+		}
+	}
+
+	if spec.BaseImage != "" {
+		_, err = machine.manage(context.Background(), "storagectl", machine.UUID.String(),
+			"--name", "SATA", "--add", "sata")
+		if err != nil {
+			return machine, err
+		}
+		_, err = machine.manage(context.Background(), "storageattach", machine.UUID.String(),
+			"--storagectl", "SATA", "--port", "0", "--device", "0",
+			"--type", "hdd", "--medium", spec.BaseImage)
+		if err != nil {
+			return machine, err
+		}
+	}
+	return machine, nil
+}
+
+// Bring the memory, CPUs and forwarding rules of the machine in line with
+// the spec, reporting whether anything changed. Zero values and forwarding
+// rules missing from the spec are left alone, and changes wait for the
+// machine to be off.
+func (machine *Machine) ApplySpec(spec MachineSpec) (bool, error) {
+	var modify []string
+	if spec.Memory != 0 && spec.Memory != machine.Memory {
+		modify = append(modify, "--memory", strconv.Itoa(spec.Memory))
+	}
+	if spec.CPUs != 0 && spec.CPUs != machine.CPUs {
+		modify = append(modify, "--cpus", strconv.Itoa(spec.CPUs))
+	}
+	current := make(map[string]PortForward, len(machine.Forwards))
+	for _, forward := range machine.Forwards {
+		current[forward.Name] = forward
+	}
+	for _, forward := range spec.Forwards {
+		if forward.Protocol == "" {
+			forward.Protocol = TCP
+		}
+		existing, found := current[forward.Name]
+		if found && existing == forward {
+			continue
+		}
+		err := forward.validate()
+		if err != nil {
+			return false, err
+		}
+		if found {
+			modify = append(modify, "--natpf1", "delete", forward.Name)
+		}
+		modify = append(modify, "--natpf1", forward.rule())
+	}
+	if len(modify) == 0 {
+		return false, nil
+	}
+	if machine.Status != Off && machine.Status != Aborted {
+		return false, fmt.Errorf("virtualbox: machine %s is %s, changes wait for it to be off",
+			machine.Name, machine.Status)
+	}
+	return true, machine.modifyVM(modify...)
+}
+
+// Power off the machine if needed and delete it along with its disks.
+func (machine *Machine) Destroy(ctx context.Context) error {
+	if machine.Status == Running || machine.Status == Paused || machine.Status == Stuck {
+		err := machine.PowerOffContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return machine.UnregisterContext(ctx, true)
+}
+
+// Read machine specs from a JSON array or from CSV with a header row naming
+// the columns name, ostype, memory, cpus, baseimage, basefolder and
+// forwards. Forwards in CSV are separated by semicolons, each in the form
+// name:protocol:hostport:guestport.
+func ParseManifest(r io.Reader) ([]MachineSpec, error) {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		reader.UnreadByte()
+		if b == '[' {
+			var specs []MachineSpec
+			err = json.NewDecoder(reader).Decode(&specs)
+			return specs, err
+		}
+		return parseCSVManifest(reader)
+	}
+}
+
+func parseCSVManifest(r io.Reader) ([]MachineSpec, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]int)
+	for index, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("virtualbox: manifest has no name column")
+	}
+
+	specs := make([]MachineSpec, 0, len(records)-1)
+	for line, record := range records[1:] {
+		field := func(name string) string {
+			if index, ok := columns[name]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		spec := MachineSpec{
+			Name:       field("name"),
+			OSType:     OSType(field("ostype")),
+			BaseImage:  field("baseimage"),
+			BaseFolder: field("basefolder"),
+		}
+		if value := field("memory"); value != "" {
+			spec.Memory, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("virtualbox: manifest line %d: %w", line+2, err)
+			}
+		}
+		if value := field("cpus"); value != "" {
+			spec.CPUs, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("virtualbox: manifest line %d: %w", line+2, err)
+			}
+		}
+		if value := field("forwards"); value != "" {
+			spec.Forwards, err = parseForwardList(value)
+			if err != nil {
+				return nil, fmt.Errorf("virtualbox: manifest line %d: %w", line+2, err)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Parse forwards in the form name:protocol:hostport:guestport;...
+func parseForwardList(text string) ([]PortForward, error) {
+	var forwards []PortForward
+	for _, item := range strings.Split(text, ";") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid forward %q", item)
+		}
+		hostPort, err := ParsePort(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		guestPort, err := ParsePort(parts[3])
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, PortForward{
+			Name:      parts[0],
+			Protocol:  Protocol(parts[1]),
+			HostPort:  hostPort,
+			GuestPort: guestPort,
+		})
+	}
+	return forwards, nil
+}
+
+// Create every machine described by the manifest, continuing past failures
+// so the report covers the whole lab. Only an unreadable manifest results in
+// an error.
+func ProvisionManifest(r io.Reader) (*ProvisionReport, error) {
+	specs, err := ParseManifest(r)
+	if err != nil {
+		return nil, err
+	}
+	report := &ProvisionReport{Results: make([]ProvisionResult, len(specs))}
+	for index, spec := range specs {
+		result := ProvisionResult{Spec: spec}
+		machine, err := spec.Create()
+		if machine != nil {
+			result.UUID = &machine.UUID
+		}
+		result.Err = err
+		report.Results[index] = result
+	}
+	return report, nil
+}
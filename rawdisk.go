@@ -0,0 +1,106 @@
+package virtualbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+)
+
+// Create a VMDK at the location that passes reads and writes through to the
+// host device, such as /dev/sdb or \\.\PhysicalDrive1. Using it needs read
+// and write access to the device, and the host must not have any of its
+// partitions mounted while the machine runs.
+func CreateRawDisk(location, device string) (*HardDisk, error) {
+	bytes, err := vboxManageMediumContext(context.Background(), "createmedium", "disk",
+		"--filename", location, "--format", "VMDK", "--variant", "RawDisk",
+		"--property", "RawDrive="+device)
+	if err != nil {
+		return nil, err
+	}
+	uuids := extractUUIDs(string(bytes))
+	if len(uuids) != 1 {
+		return nil, errors.New("virtualbox: createmedium did not report the UUID")
+	}
+	return &HardDisk{
+		UUID:     *uuids[0],
+		Location: location,
+		Format:   HardDiskFormat("VMDK"),
+		Type:     Normal,
+	}, nil
+}
+
+// Create a machine from the spec that boots the physical host device, by
+// attaching a raw VMDK wrapping it, stored next to the settings file, to
+// the first SATA port. The guest writes to the device, so for forensic use
+// make the disk immutable with "modifymedium --type immutable" to keep the
+// writes in a differencing image. On failure after the machine was created
+// it is returned along with the error.
+func WrapPhysicalDisk(dev string, spec MachineSpec) (*Machine, error) {
+	if spec.BaseImage != "" {
+		return nil, errors.New("virtualbox: the physical disk replaces the base image")
+	}
+	machine, err := spec.Create()
+	if err != nil {
+		return machine, err
+	}
+	location := filepath.Join(filepath.Dir(machine.Source), machine.Name+"-raw.vmdk")
+	disk, err := CreateRawDisk(location, dev)
+	if err != nil {
+		return machine, err
+	}
+	_, err = machine.CreateStorageController("SATA", BusSATA)
+	if err != nil {
+		return machine, err
+	}
+	return machine, machine.AttachDisk("SATA", 0, 0, disk, DeviceHardDisk)
+}
+
+// Write the contents of the disk image, along with the differencing images
+// below it, to a raw image at the path so the host can inspect the guest
+// files, for example with a read-only loop mount. The copy is unregistered
+// again, leaving only the file. The machine using the disk should be off.
+func (disk *HardDisk) ExportRaw(path string) error {
+	return disk.ExportRawContext(context.Background(), path)
+}
+
+// Write the raw image, killing VBoxManage if the context is done first.
+func (disk *HardDisk) ExportRawContext(ctx context.Context, path string) error {
+	bytes, err := vboxManageMediumContext(ctx, "clonemedium", "disk",
+		disk.UUID.String(), path, "--format", "RAW")
+	if err != nil {
+		return err
+	}
+	uuids := extractUUIDs(string(bytes))
+	if len(uuids) != 1 {
+		return errors.New("virtualbox: clonemedium did not report the UUID")
+	}
+	_, err = vboxManageModifyContext(ctx, "closemedium", "disk", uuids[0].String())
+	return err
+}
+
+// Stream the raw contents of the disk image file to w, without writing a
+// copy to disk first. VBoxManage reads the file directly, so it only works
+// for base images that are not in use; use ExportRaw for differencing ones.
+func (disk *HardDisk) WriteRaw(ctx context.Context, w io.Writer) (err error) {
+	release, err := acquireMediumSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	releaseCommand, err := acquireCommandSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer releaseCommand()
+
+	args := []string{"internalcommands", "converttoraw", disk.Location, "stdout"}
+	ctx, endSpan := startSpan(ctx, "VBoxManage", commandAttributes(args))
+	defer func() { endSpan(err) }()
+	var stderr bytes.Buffer
+	command := vboxManageCommand(ctx, MediumPriority.wrapper(), args...)
+	command.Stdout, command.Stderr = w, &stderr
+	err = command.Run()
+	return commandError(args, stderr.Bytes(), err)
+}
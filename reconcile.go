@@ -0,0 +1,217 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Provides the specs of the machines that should exist.
+type ManifestSource interface {
+	Specs(ctx context.Context) ([]MachineSpec, error)
+}
+
+// Reads the .json and .csv files in a directory, in the formats accepted by
+// ParseManifest.
+type DirectoryManifests struct {
+	Dir string
+}
+
+func (source DirectoryManifests) Specs(ctx context.Context) ([]MachineSpec, error) {
+	entries, err := os.ReadDir(source.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var specs []MachineSpec
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".json" && ext != ".csv") {
+			continue
+		}
+		file, err := os.Open(filepath.Join(source.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fileSpecs, err := ParseManifest(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("virtualbox: manifest %s: %w", entry.Name(), err)
+		}
+		specs = append(specs, fileSpecs...)
+	}
+	return specs, nil
+}
+
+// Fetches a manifest in a format accepted by ParseManifest with GET.
+type HTTPManifests struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (source HTTPManifests) Specs(ctx context.Context) ([]MachineSpec, error) {
+	client := source.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("virtualbox: fetching %s: %s", source.URL, response.Status)
+	}
+	return ParseManifest(response.Body)
+}
+
+// What the reconciler did to a machine.
+type ReconcileAction string
+
+const (
+	ReconcileCreated = ReconcileAction("created")
+	ReconcileUpdated = ReconcileAction("updated")
+	ReconcileDeleted = ReconcileAction("deleted")
+)
+
+// Continuously converges the machines in a group to the specs from a
+// source. Missing machines are created in the group, the memory, CPUs and
+// forwarding rules of existing ones are updated while they are off, and
+// with Prune the machines in the group no spec names are deleted along with
+// their disks. Machines outside the group, including those in its
+// subgroups, are never deleted, and nothing is pruned while the source
+// returns no specs.
+type Reconciler struct {
+	Source   ManifestSource
+	Group    string        // such as "/lab", required
+	Interval time.Duration // PollInterval if zero
+	Prune    bool
+
+	OnChange func(name string, action ReconcileAction) // optional
+	OnError  func(name string, err error)              // optional
+}
+
+func (reconciler *Reconciler) reportError(name string, err error) {
+	if err != nil && reconciler.OnError != nil {
+		reconciler.OnError(name, err)
+	}
+}
+
+func (reconciler *Reconciler) reportChange(name string, action ReconcileAction) {
+	if reconciler.OnChange != nil {
+		reconciler.OnChange(name, action)
+	}
+}
+
+// Converge the group to the specs once. Failing to get the specs or decode
+// the machines is returned, failures for single machines are reported to
+// OnError.
+func (reconciler *Reconciler) RunOnce(ctx context.Context) error {
+	if reconciler.Group == "" {
+		return errors.New("virtualbox: the reconciler needs a group")
+	}
+	specs, err := reconciler.Source.Specs(ctx)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]MachineSpec, len(specs))
+	for _, spec := range specs {
+		if _, found := wanted[spec.Name]; found {
+			return fmt.Errorf("virtualbox: machine %s is specified twice", spec.Name)
+		}
+		wanted[spec.Name] = spec
+	}
+
+	configPath, err := DefaultPath()
+	if err != nil {
+		return err
+	}
+	vbox, err := Decode(configPath, WithGroupFilter(reconciler.Group))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*Machine, len(vbox.Machines))
+	for _, machine := range vbox.Machines {
+		existing[machine.Name] = machine
+	}
+
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		spec := wanted[name]
+		machine := existing[name]
+		if machine == nil {
+			spec.Groups = []string{reconciler.Group}
+			_, err := spec.Create()
+			reconciler.reportError(name, err)
+			if err == nil {
+				reconciler.reportChange(name, ReconcileCreated)
+			}
+			continue
+		}
+		changed, err := machine.ApplySpec(spec)
+		reconciler.reportError(name, err)
+		if changed {
+			reconciler.reportChange(name, ReconcileUpdated)
+		}
+	}
+
+	if !reconciler.Prune {
+		return nil
+	}
+	if len(specs) == 0 {
+		return errors.New("virtualbox: the source returned no specs, not pruning")
+	}
+	for name, machine := range existing {
+		if _, found := wanted[name]; found || ctx.Err() != nil {
+			continue
+		}
+		if !inExactGroup(machine.Groups, reconciler.Group) {
+			continue
+		}
+		err := machine.Destroy(ctx)
+		reconciler.reportError(name, err)
+		if err == nil {
+			reconciler.reportChange(name, ReconcileDeleted)
+		}
+	}
+	return ctx.Err()
+}
+
+// Converge the group every Interval until the context is done. Errors of
+// a pass are reported to OnError under an empty name.
+func (reconciler *Reconciler) Run(ctx context.Context) error {
+	interval := reconciler.Interval
+	if interval == 0 {
+		interval = PollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := reconciler.RunOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		reconciler.reportError("", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
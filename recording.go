@@ -0,0 +1,55 @@
+package virtualbox
+
+// Screen recording settings, stored in the Recording element since
+// VirtualBox 6.1.
+type Recording struct {
+	Enabled bool
+	Screens []RecordingScreen `json:",omitempty"`
+}
+
+type RecordingScreen struct {
+	ID          int
+	Enabled     bool
+	File        string `json:",omitempty"`
+	Options     string `json:",omitempty"`
+	MaxTime     int    `json:",omitempty"` // seconds
+	MaxSize     int    `json:",omitempty"` // megabytes
+	VideoWidth  int    `json:",omitempty"`
+	VideoHeight int    `json:",omitempty"`
+	VideoRate   int    `json:",omitempty"` // kilobits per second
+	VideoFPS    int    `json:",omitempty"`
+}
+
+type xmlRecordingScreen struct {
+	ID          int    `xml:"id,attr"`
+	Enabled     bool   `xml:"enabled,attr"`
+	File        string `xml:"file,attr"`
+	Options     string `xml:"options,attr"`
+	MaxTime     int    `xml:"maxTime,attr"`
+	MaxSize     int    `xml:"maxSize,attr"`
+	VideoWidth  int    `xml:"videoWidth,attr"`
+	VideoHeight int    `xml:"videoHeight,attr"`
+	VideoRate   int    `xml:"videoRate,attr"`
+	VideoFPS    int    `xml:"videoFPS,attr"`
+}
+
+type xmlRecording struct {
+	Enabled bool                 `xml:"enabled,attr"`
+	Screens []xmlRecordingScreen `xml:"Screen"`
+}
+
+type xmlNVRAM struct {
+	Path string `xml:"path,attr"`
+}
+
+// Convert the Recording element, returning nil if it was absent.
+func (xmlRecording *xmlRecording) recording() *Recording {
+	if !xmlRecording.Enabled && len(xmlRecording.Screens) == 0 {
+		return nil
+	}
+	recording := &Recording{Enabled: xmlRecording.Enabled}
+	for _, screen := range xmlRecording.Screens {
+		recording.Screens = append(recording.Screens, RecordingScreen(screen))
+	}
+	return recording
+}
@@ -0,0 +1,109 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Returned by Recover when a machine cannot be brought back to a usable
+// running state and should be replaced.
+var ErrUnusable = errors.New("virtualbox: machine is not usable")
+
+// Map the showvminfo VMState value to a Status. States of transitions that
+// have no Status of their own map to the closest one.
+func parseVMState(state string) Status {
+	switch state {
+	case "poweroff":
+		return Off
+	case "running":
+		return Running
+	case "paused":
+		return Paused
+	case "saved":
+		return Saved
+	case "gurumeditation", "stuck":
+		return Stuck
+	case "aborted", "aborted-saved":
+		return Aborted
+	case "starting":
+		return Starting
+	case "stopping":
+		return Stopping
+	case "saving":
+		return Saving
+	case "restoring":
+		return Restoring
+	case "snapshotting", "livesnapshotting", "onlinesnapshotting", "restoringsnapshot",
+		"deletingsnapshot", "deletingsnapshotlive", "deletingsnapshotlivepaused":
+		return Snapshotting
+	case "teleporting", "teleportingpausedvm", "teleportingin":
+		return Teleporting
+	case "teleported":
+		return Teleported
+	case "settingup":
+		return SettingUp
+	}
+	return Unknown
+}
+
+// Parse the time of the last state change, given in UTC by the machine XML
+// and without a zone by showvminfo. Invalid times are treated as unknown.
+func parseStateChangeTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Query the current state of the machine from VirtualBox.
+func (machine *Machine) queryStatus() (Status, error) {
+	info, err := showVMInfo(machine.UUID.String())
+	if err != nil {
+		return "", err
+	}
+	return parseVMState(info["VMState"]), nil
+}
+
+// Update the Status and LastStateChange with the state VirtualBox reports,
+// instead of the one found by Decode through StatusSource.
+func (machine *Machine) RefreshState() error {
+	return machine.RefreshStateContext(context.Background())
+}
+
+// Update the state, killing VBoxManage if the context is done first.
+func (machine *Machine) RefreshStateContext(ctx context.Context) error {
+	found, _, err := showMachine(ctx, machine.UUID.String())
+	if err != nil {
+		return err
+	}
+	machine.Status = found.Status
+	machine.LastStateChange = found.LastStateChange
+	return nil
+}
+
+// Make sure a machine that should be running is usable, resuming it if it
+// was paused. Stuck machines, and paused ones that fail to resume, result in
+// an error wrapping ErrUnusable so that callers handing out machines can
+// replace them with fresh ones.
+func (machine *Machine) Recover() error {
+	status, err := machine.queryStatus()
+	if err != nil {
+		return err
+	}
+	machine.Status = status
+	switch status {
+	case Running:
+		return nil
+	case Paused:
+		err = machine.Resume()
+		if err != nil {
+			return fmt.Errorf("%w: resume failed: %v", ErrUnusable, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: machine is %s", ErrUnusable, status)
+}
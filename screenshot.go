@@ -0,0 +1,124 @@
+package virtualbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+)
+
+type ScreenshotFormat string
+
+const (
+	ScreenshotPNG = ScreenshotFormat("png")
+	ScreenshotBMP = ScreenshotFormat("bmp") // 24 bits, converted from the PNG
+)
+
+// Capture the first screen of the running machine as PNG data. This only
+// reads the machine, so it also works with ReadOnly set.
+func (machine *Machine) screenshotPNG() ([]byte, error) {
+	err := machine.checkNamespace()
+	if err != nil {
+		return nil, err
+	}
+	name, remove, err := commandTempFile("screenshot-*.png")
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+	_, err = vboxManageContext(context.Background(), "controlvm", machine.UUID.String(),
+		"screenshotpng", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(name)
+}
+
+// Capture the screen of the running machine and write it to w in the
+// format, such as to keep what a failing test showed.
+func (machine *Machine) Screenshot(w io.Writer, format ScreenshotFormat) error {
+	data, err := machine.screenshotPNG()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case ScreenshotPNG:
+		_, err = w.Write(data)
+		return err
+	case ScreenshotBMP:
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		return writeBMP(w, img)
+	}
+	return fmt.Errorf("virtualbox: unknown screenshot format %q", format)
+}
+
+// Capture the screen of the running machine as an image.
+func (machine *Machine) ScreenshotImage() (image.Image, error) {
+	data, err := machine.screenshotPNG()
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// Encode the image as an uncompressed 24 bit BMP with the rows stored
+// bottom up, as most readers expect.
+func writeBMP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rowSize := (width*3 + 3) &^ 3
+	const headerSize = 14 + 40
+	header := struct {
+		Magic           [2]byte
+		FileSize        uint32
+		Reserved        uint32
+		DataOffset      uint32
+		InfoSize        uint32
+		Width           int32
+		Height          int32
+		Planes          uint16
+		BitsPerPixel    uint16
+		Compression     uint32
+		ImageSize       uint32
+		XPixelsPerM     int32
+		YPixelsPerM     int32
+		ColorsUsed      uint32
+		ColorsImportant uint32
+	}{
+		Magic:        [2]byte{'B', 'M'},
+		FileSize:     uint32(headerSize + rowSize*height),
+		DataOffset:   headerSize,
+		InfoSize:     40,
+		Width:        int32(width),
+		Height:       int32(height),
+		Planes:       1,
+		BitsPerPixel: 24,
+		ImageSize:    uint32(rowSize * height),
+		XPixelsPerM:  2835, // 72 DPI
+		YPixelsPerM:  2835,
+	}
+	err := binary.Write(w, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	row := make([]byte, rowSize)
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			offset := (x - bounds.Min.X) * 3
+			row[offset], row[offset+1], row[offset+2] = byte(b>>8), byte(g>>8), byte(r>>8)
+		}
+		_, err = w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The guest property path secrets are delivered under, so the guest reads
+// the secret db-password with "VBoxControl guestproperty get
+// /Secrets/db-password".
+const SecretPropertyPrefix = "/Secrets/"
+
+// Transient properties are never written to the settings file, and
+// TRANSRESET also drops them when the guest resets.
+const secretPropertyFlags = "TRANSIENT,TRANSRESET"
+
+// Deliver the secrets to the running machine as transient guest properties
+// named SecretPropertyPrefix followed by the key, which live only in
+// memory and are gone on reset or power off. The guest can delete each
+// property once read. The returned function removes the remaining ones;
+// call it once the guest has consumed them. If delivering any fails, those
+// already delivered are removed again.
+func (machine *Machine) DeliverSecrets(secrets map[string]string) (scrub func() error, err error) {
+	if machine.Status != Running {
+		return nil, fmt.Errorf("virtualbox: machine %s is %s, secrets need it running",
+			machine.Name, machine.Status)
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		if name == "" || strings.HasPrefix(name, "/") {
+			return nil, fmt.Errorf("virtualbox: invalid secret name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var delivered []string
+	scrub = func() error {
+		var errs []error
+		for _, name := range delivered {
+			_, err := machine.manage(context.Background(), "guestproperty", "set",
+				machine.UUID.String(), SecretPropertyPrefix+name)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		delivered = nil
+		return errors.Join(errs...)
+	}
+	for _, name := range names {
+		_, err = machine.manage(context.Background(), "guestproperty", "set",
+			machine.UUID.String(), SecretPropertyPrefix+name, secrets[name],
+			"--flags", secretPropertyFlags)
+		if err != nil {
+			scrub()
+			return nil, err
+		}
+		delivered = append(delivered, name)
+	}
+	return scrub, nil
+}
@@ -0,0 +1,90 @@
+package virtualbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"time"
+)
+
+// Returned by operations that change machine settings when the settings file
+// was modified, for example by the VirtualBox GUI, after it was decoded.
+var ErrConcurrentModification = errors.New("virtualbox: machine settings modified since they were decoded")
+
+// Identifies the contents of a settings file at the time it was read.
+type settingsFingerprint struct {
+	modTime time.Time
+	size    int64
+	hash    []byte
+}
+
+func fingerprintSettings(source string, data []byte) (*settingsFingerprint, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return &settingsFingerprint{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    hash[:],
+	}, nil
+}
+
+// Check the settings file has not changed since the machine was decoded or
+// last changed by us. Machines that were not decoded from a settings file
+// always pass.
+func (machine *Machine) CheckUnmodified() error {
+	unlock, err := lockMachine(context.Background(), machine.UUID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return machine.checkUnmodified()
+}
+
+// Check the settings file like CheckUnmodified, with the machine lock held.
+func (machine *Machine) checkUnmodified() error {
+	if machine.fingerprint == nil {
+		return nil
+	}
+	info, err := os.Stat(machine.Source)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(machine.fingerprint.modTime) &&
+		info.Size() == machine.fingerprint.size {
+		return nil
+	}
+	// the file was touched, only fail if the contents actually differ
+	data, err := os.ReadFile(machine.Source)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+	if !bytes.Equal(hash[:], machine.fingerprint.hash) {
+		return ErrConcurrentModification
+	}
+	return nil
+}
+
+// Record the current settings file as the one our copy is based on, after
+// changing it ourselves, with the machine lock held. On failure further
+// checks are disabled rather than failing on our own modification.
+func (machine *Machine) refreshFingerprint() {
+	machine.fingerprint = nil
+	data, err := os.ReadFile(machine.Source)
+	if err != nil {
+		return
+	}
+	machine.fingerprint, _ = fingerprintSettings(machine.Source, data)
+}
+
+// Run modifyvm against the machine.
+func (machine *Machine) modifyVM(args ...string) error {
+	_, err := machine.manage(context.Background(),
+		append([]string{"modifyvm", machine.UUID.String()}, args...)...)
+	return err
+}
@@ -0,0 +1,70 @@
+package virtualbox
+
+import (
+	"context"
+)
+
+// A host directory shared with the guest through the Guest Additions.
+type SharedFolder struct {
+	Name       string
+	HostPath   string
+	Writable   bool
+	AutoMount  bool
+	MountPoint string `json:",omitempty"` // for AutoMount, a default one is chosen if empty
+}
+
+type xmlSharedFolder struct {
+	Name           string `xml:"name,attr"`
+	HostPath       string `xml:"hostPath,attr"`
+	Writable       bool   `xml:"writable,attr"`
+	AutoMount      bool   `xml:"autoMount,attr"`
+	AutoMountPoint string `xml:"autoMountPoint,attr"`
+}
+
+// Run a sharedfolder subcommand against the machine.
+func (machine *Machine) sharedFolderCommand(args ...string) error {
+	_, err := machine.manage(context.Background(), args...)
+	return err
+}
+
+// Share the host directory with the guest under the name. Automounted
+// folders are mounted by the Guest Additions, on Linux guests under /media
+// for members of the vboxsf group.
+func (machine *Machine) AddSharedFolder(name, hostPath string, writable, automount bool) error {
+	args := []string{"sharedfolder", "add", machine.UUID.String(),
+		"--name", name, "--hostpath", hostPath}
+	if !writable {
+		args = append(args, "--readonly")
+	}
+	if automount {
+		args = append(args, "--automount")
+	}
+	err := machine.sharedFolderCommand(args...)
+	if err != nil {
+		return err
+	}
+	machine.SharedFolders = append(machine.SharedFolders, SharedFolder{
+		Name:      name,
+		HostPath:  hostPath,
+		Writable:  writable,
+		AutoMount: automount,
+	})
+	return nil
+}
+
+// Stop sharing the folder with the given name.
+func (machine *Machine) RemoveSharedFolder(name string) error {
+	err := machine.sharedFolderCommand("sharedfolder", "remove",
+		machine.UUID.String(), "--name", name)
+	if err != nil {
+		return err
+	}
+	folders := machine.SharedFolders[:0]
+	for _, folder := range machine.SharedFolders {
+		if folder.Name != name {
+			folders = append(folders, folder)
+		}
+	}
+	machine.SharedFolders = folders
+	return nil
+}
@@ -0,0 +1,91 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ShutdownMethod string
+
+const (
+	ShutdownGuest     = ShutdownMethod("guest")     // Guest Additions, VirtualBox 7 and later
+	ShutdownACPI      = ShutdownMethod("acpi")      // ACPI power button
+	ShutdownSaveState = ShutdownMethod("savestate") // save the state to disk
+	ShutdownPowerOff  = ShutdownMethod("poweroff")  // hard power off
+)
+
+type ShutdownStep struct {
+	Method  ShutdownMethod
+	Timeout time.Duration // time allowed for the machine to stop, 0 for no limit
+}
+
+type ShutdownOptions struct {
+	Steps []ShutdownStep // tried in order, DefaultShutdownSteps if empty
+}
+
+// The ladder used when ShutdownOptions has no steps.
+var DefaultShutdownSteps = []ShutdownStep{
+	{ShutdownGuest, 2 * time.Minute},
+	{ShutdownACPI, 2 * time.Minute},
+	{ShutdownSaveState, time.Minute},
+	{ShutdownPowerOff, 30 * time.Second},
+}
+
+// Start stopping the machine with the method, returning the state that
+// indicates success.
+func (machine *Machine) triggerShutdown(ctx context.Context, method ShutdownMethod) (Status, error) {
+	switch method {
+	case ShutdownGuest:
+		_, err := machine.manage(ctx,
+			"controlvm", machine.UUID.String(), "shutdown")
+		return Off, err
+	case ShutdownACPI:
+		return Off, machine.ACPIPowerButton()
+	case ShutdownSaveState:
+		return Saved, machine.SaveState()
+	case ShutdownPowerOff:
+		return Off, machine.PowerOffContext(ctx)
+	}
+	return "", fmt.Errorf("virtualbox: unknown shutdown method %q", method)
+}
+
+// Stop the machine trying each step in turn until one brings it to a halt
+// within its timeout, and return the method that succeeded. When all steps
+// fail the error includes the reason for each.
+func (machine *Machine) Shutdown(ctx context.Context, options ShutdownOptions) (ShutdownMethod, error) {
+	steps := options.Steps
+	if len(steps) == 0 {
+		steps = DefaultShutdownSteps
+	}
+	var errs []error
+	for _, step := range steps {
+		want, err := machine.triggerShutdown(ctx, step.Method)
+		if err == nil {
+			stepCtx, cancel := ctx, context.CancelFunc(func() {})
+			if step.Timeout != 0 {
+				stepCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+			}
+			err = machine.waitStatus(stepCtx, want)
+			cancel()
+			if err == nil {
+				return step.Method, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", step.Method, err))
+	}
+	return "", fmt.Errorf("virtualbox: shutdown failed: %w", errors.Join(errs...))
+}
+
+// Press the ACPI power button and power the machine off if the guest has
+// not halted within the timeout, returning the method that stopped it.
+func (machine *Machine) ShutdownTimeout(ctx context.Context, timeout time.Duration) (ShutdownMethod, error) {
+	return machine.Shutdown(ctx, ShutdownOptions{Steps: []ShutdownStep{
+		{ShutdownACPI, timeout},
+		{ShutdownPowerOff, 30 * time.Second},
+	}})
+}
@@ -0,0 +1,206 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+type Snapshot struct {
+	UUID        uuid.UUID
+	Name        string
+	Description string `json:",omitempty"`
+	TimeStamp   time.Time
+	Online      bool         `json:",omitempty"` // includes the saved state of a running machine
+	Parent      *uuid.UUID   `json:",omitempty"`
+	Children    []*uuid.UUID `json:",omitempty"`
+}
+
+type xmlSnapshot struct {
+	UUID        string        `xml:"uuid,attr"`
+	Name        string        `xml:"name,attr"`
+	TimeStamp   string        `xml:"timeStamp,attr"`
+	StateFile   string        `xml:"stateFile,attr"`
+	Description string        `xml:"Description"`
+	Children    []xmlSnapshot `xml:"Snapshots>Snapshot"`
+}
+
+// Flatten the snapshot tree, parents before their children.
+func (xmlSnapshot *xmlSnapshot) snapshots(parent *uuid.UUID) ([]*Snapshot, error) {
+	snapshotUUID, err := uuid.ParseHex(xmlSnapshot.UUID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		UUID:        *snapshotUUID,
+		Name:        xmlSnapshot.Name,
+		Description: xmlSnapshot.Description,
+		TimeStamp:   parseStateChangeTime(xmlSnapshot.TimeStamp),
+		Online:      xmlSnapshot.StateFile != "",
+		Parent:      parent,
+	}
+	snapshots := []*Snapshot{snapshot}
+	for _, xmlChild := range xmlSnapshot.Children {
+		children, err := xmlChild.snapshots(&snapshot.UUID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Children = append(snapshot.Children, &children[0].UUID)
+		snapshots = append(snapshots, children...)
+	}
+	return snapshots, nil
+}
+
+// Find a snapshot of the machine.
+func (machine *Machine) Snapshot(snapshotUUID uuid.UUID) *Snapshot {
+	for _, snapshot := range machine.Snapshots {
+		if snapshot.UUID == snapshotUUID {
+			return snapshot
+		}
+	}
+	return nil
+}
+
+// Get the latest snapshot of the machine with the name.
+func (machine *Machine) snapshotNamed(name string) *Snapshot {
+	var latest *Snapshot
+	for _, snapshot := range machine.Snapshots {
+		if snapshot.Name == name && (latest == nil || snapshot.TimeStamp.After(latest.TimeStamp)) {
+			latest = snapshot
+		}
+	}
+	return latest
+}
+
+// Run a snapshot subcommand against the machine.
+func (machine *Machine) snapshotCommand(medium bool, args ...string) ([]byte, error) {
+	args = append([]string{"snapshot", machine.UUID.String()}, args...)
+	manage := machine.manage
+	if medium {
+		manage = machine.manageMedium
+	}
+	return manage(context.Background(), args...)
+}
+
+// Take a snapshot of the current state of the machine, which becomes the
+// current snapshot.
+func (machine *Machine) TakeSnapshot(name, description string) (_ *Snapshot, err error) {
+	started := time.Now()
+	defer func() { machine.emit(OperationTakeSnapshot, started, err) }()
+	args := []string{"take", name}
+	if description != "" {
+		args = append(args, "--description", description)
+	}
+	bytes, err := machine.snapshotCommand(false, args...)
+	if err != nil {
+		return nil, err
+	}
+	uuids := extractUUIDs(string(bytes))
+	if len(uuids) == 0 {
+		return nil, errors.New("virtualbox: snapshot take did not report the UUID")
+	}
+	snapshot := &Snapshot{
+		UUID:        *uuids[len(uuids)-1],
+		Name:        name,
+		Description: description,
+		TimeStamp:   time.Now().UTC(),
+		Online:      machine.Status == Running || machine.Status == Paused,
+		Parent:      machine.CurrentSnapshot,
+	}
+	if parent := machine.currentSnapshot(); parent != nil {
+		parent.Children = append(parent.Children, &snapshot.UUID)
+	}
+	machine.Snapshots = append(machine.Snapshots, snapshot)
+	machine.CurrentSnapshot = &snapshot.UUID
+	return snapshot, nil
+}
+
+func (machine *Machine) currentSnapshot() *Snapshot {
+	if machine.CurrentSnapshot == nil {
+		return nil
+	}
+	return machine.Snapshot(*machine.CurrentSnapshot)
+}
+
+// Restore the machine to the given snapshot, which becomes the current
+// snapshot. The machine must not be running. The attachments are read
+// again, as restoring replaces the differencing images.
+func (machine *Machine) RestoreSnapshot(snapshotUUID uuid.UUID) (err error) {
+	started := time.Now()
+	defer func() { machine.emit(OperationRestoreSnapshot, started, err) }()
+	snapshot := machine.Snapshot(snapshotUUID)
+	if snapshot == nil {
+		return fmt.Errorf("virtualbox: machine %s has no snapshot %s",
+			machine.Name, snapshotUUID.String())
+	}
+	_, err = machine.snapshotCommand(false, "restore", snapshotUUID.String())
+	if err != nil {
+		return err
+	}
+	machine.CurrentSnapshot = &snapshot.UUID
+	// restoring an offline snapshot discards the current saved state
+	machine.Status = Off
+	if snapshot.Online {
+		machine.Status = Saved
+	}
+	if machine.Source == "" {
+		return nil
+	}
+	restored, _, err := decodeMachineFile(&machine.UUID, machine.Source)
+	if err != nil {
+		return err
+	}
+	machine.StorageControllers = restored.StorageControllers
+	machine.HardDisks = restored.HardDisks
+	return nil
+}
+
+// Delete the given snapshot, merging its disk images. Its children are moved
+// to its parent, which becomes the current snapshot if it was the current
+// one.
+func (machine *Machine) DeleteSnapshot(snapshotUUID uuid.UUID) (err error) {
+	started := time.Now()
+	defer func() { machine.emit(OperationDeleteSnapshot, started, err) }()
+	snapshot := machine.Snapshot(snapshotUUID)
+	if snapshot == nil {
+		return fmt.Errorf("virtualbox: machine %s has no snapshot %s",
+			machine.Name, snapshotUUID.String())
+	}
+	_, err = machine.snapshotCommand(true, "delete", snapshotUUID.String())
+	if err != nil {
+		return err
+	}
+
+	var parent *Snapshot
+	if snapshot.Parent != nil {
+		parent = machine.Snapshot(*snapshot.Parent)
+	}
+	if parent != nil {
+		children := parent.Children[:0]
+		for _, child := range parent.Children {
+			if *child != snapshotUUID {
+				children = append(children, child)
+			}
+		}
+		parent.Children = append(children, snapshot.Children...)
+	}
+	for _, child := range snapshot.Children {
+		if childSnapshot := machine.Snapshot(*child); childSnapshot != nil {
+			childSnapshot.Parent = snapshot.Parent
+		}
+	}
+	snapshots := machine.Snapshots[:0]
+	for _, other := range machine.Snapshots {
+		if other != snapshot {
+			snapshots = append(snapshots, other)
+		}
+	}
+	machine.Snapshots = snapshots
+	if machine.CurrentSnapshot != nil && *machine.CurrentSnapshot == snapshotUUID {
+		machine.CurrentSnapshot = snapshot.Parent
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Changes how StartGroup starts machines.
+type StartGroupOption func(*startGroupOptions)
+
+type startGroupOptions struct {
+	frontend    Frontend
+	healthCheck func(ctx context.Context, machine *Machine) error
+}
+
+// Start the machines with the frontend instead of headless.
+func WithStartFrontend(frontend Frontend) StartGroupOption {
+	return func(options *startGroupOptions) {
+		options.frontend = frontend
+	}
+}
+
+// Check every machine of a tier with the function, which should return
+// once the machine is ready to serve its dependents, before starting the
+// next tier. Without one a tier is done when startvm returns.
+func WithHealthCheck(check func(ctx context.Context, machine *Machine) error) StartGroupOption {
+	return func(options *startGroupOptions) {
+		options.healthCheck = check
+	}
+}
+
+// Order the machines into tiers, where each machine comes after the
+// machines it depends on, and machines in a tier are sorted by name.
+func startTiers(machines []*Machine, deps map[string][]string) ([][]*Machine, error) {
+	byName := make(map[string]*Machine, len(machines))
+	for _, machine := range machines {
+		byName[machine.Name] = machine
+	}
+	remaining := make(map[string]int, len(machines))
+	dependents := make(map[string][]string)
+	for _, machine := range machines {
+		remaining[machine.Name] = 0
+	}
+	for name, needs := range deps {
+		if byName[name] == nil {
+			return nil, fmt.Errorf("virtualbox: dependencies of unknown machine %s", name)
+		}
+		for _, need := range needs {
+			if byName[need] == nil {
+				return nil, fmt.Errorf("virtualbox: machine %s depends on unknown machine %s", name, need)
+			}
+			remaining[name]++
+			dependents[need] = append(dependents[need], name)
+		}
+	}
+
+	var tiers [][]*Machine
+	var ready []string
+	for name, count := range remaining {
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+	for len(ready) != 0 {
+		sort.Strings(ready)
+		tier := make([]*Machine, 0, len(ready))
+		var next []string
+		for _, name := range ready {
+			tier = append(tier, byName[name])
+			delete(remaining, name)
+			for _, dependent := range dependents[name] {
+				remaining[dependent]--
+				if remaining[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		tiers = append(tiers, tier)
+		ready = next
+	}
+	if len(remaining) != 0 {
+		cycle := make([]string, 0, len(remaining))
+		for name := range remaining {
+			cycle = append(cycle, name)
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("virtualbox: dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+	return tiers, nil
+}
+
+// Start the machines in dependency order, where deps maps a machine name to
+// the names of the machines it needs, such as a database before the
+// application servers using it. Machines whose dependencies are all up
+// start together, and each tier must pass the health check before the next
+// one starts. Machines already running are only checked. After a tier
+// fails, the remaining tiers are not started and the machines already
+// started are left running.
+func StartGroup(ctx context.Context, machines []*Machine, deps map[string][]string, opts ...StartGroupOption) error {
+	options := startGroupOptions{frontend: Headless}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	tiers, err := startTiers(machines, deps)
+	if err != nil {
+		return err
+	}
+	for _, tier := range tiers {
+		errs := make([]error, len(tier))
+		var wait sync.WaitGroup
+		for index, machine := range tier {
+			wait.Add(1)
+			go func(index int, machine *Machine) {
+				defer wait.Done()
+				if machine.Status != Running {
+					err := machine.StartFrontendContext(ctx, options.frontend)
+					if err != nil {
+						errs[index] = fmt.Errorf("virtualbox: starting %s: %w", machine.Name, err)
+						return
+					}
+				}
+				if options.healthCheck != nil {
+					err := options.healthCheck(ctx, machine)
+					if err != nil {
+						errs[index] = fmt.Errorf("virtualbox: health check of %s: %w", machine.Name, err)
+					}
+				}
+			}(index, machine)
+		}
+		wait.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
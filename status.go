@@ -0,0 +1,136 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Determines which machines are running.
+type StatusProvider interface {
+	RunningMachines(ctx context.Context) (map[uuid.UUID]bool, error)
+}
+
+// Uses "VBoxManage list runningvms", which needs a responsive VBoxSVC.
+type VBoxManageStatus struct {
+	Timeout time.Duration // 0 for no limit
+}
+
+func (provider VBoxManageStatus) RunningMachines(ctx context.Context) (map[uuid.UUID]bool, error) {
+	if provider.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, provider.Timeout)
+		defer cancel()
+	}
+	return runningMachineUUIDs(ctx)
+}
+
+// Scans the process table for the VBoxHeadless and VirtualBoxVM processes
+// hosting machines, identifying them by their --startvm argument. This works
+// when VBoxSVC is down, but only for machines started by UUID, which is what
+// VirtualBox itself does.
+type ProcessTableStatus struct{}
+
+var vmProcessNames = []string{"VBoxHeadless", "VirtualBoxVM", "VirtualBox"}
+
+func (ProcessTableStatus) RunningMachines(ctx context.Context) (map[uuid.UUID]bool, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("virtualbox: process table status is not supported on windows")
+	}
+	bytes, err := newCommand(ctx, "ps", "-axww", "-o", "args=").Output()
+	if err != nil {
+		return nil, err
+	}
+	uuids := make(map[uuid.UUID]bool)
+	for _, line := range strings.Split(string(bytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !isVMProcess(fields[0]) {
+			continue
+		}
+		for index, field := range fields[:len(fields)-1] {
+			if field != "--startvm" {
+				continue
+			}
+			if parsed := extractUUIDs(fields[index+1]); len(parsed) == 1 {
+				uuids[*parsed[0]] = true
+			}
+		}
+	}
+	return uuids, nil
+}
+
+func isVMProcess(exe string) bool {
+	exe = exe[strings.LastIndexAny(exe, `/\`)+1:]
+	for _, name := range vmProcessNames {
+		if exe == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Tries each provider in turn, using the first one that succeeds.
+type FallbackStatus []StatusProvider
+
+func (providers FallbackStatus) RunningMachines(ctx context.Context) (map[uuid.UUID]bool, error) {
+	var errs []error
+	for _, provider := range providers {
+		uuids, err := provider.RunningMachines(ctx)
+		if err == nil {
+			return uuids, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// The provider used by Decode to determine which machines are running.
+var StatusSource StatusProvider = FallbackStatus{
+	VBoxManageStatus{Timeout: 30 * time.Second},
+	ProcessTableStatus{},
+}
+
+// How long the result of StatusSource is reused by Decode and other status
+// checks. Zero disables caching.
+var StatusCacheTTL = 2 * time.Second
+
+var statusCache struct {
+	sync.Mutex
+	uuids   map[uuid.UUID]bool
+	fetched time.Time
+}
+
+// Discard the cached running machines, so the next check queries
+// StatusSource. Operations changing a machine through this package do this
+// automatically, callers need it after changing StatusSource or changing
+// machines by other means.
+func InvalidateStatusCache() {
+	statusCache.Lock()
+	statusCache.uuids = nil
+	statusCache.Unlock()
+}
+
+// Get the running machines from StatusSource, sharing results within
+// StatusCacheTTL. Concurrent callers wait for a single query.
+func runningMachines(ctx context.Context) (map[uuid.UUID]bool, error) {
+	statusCache.Lock()
+	defer statusCache.Unlock()
+	if statusCache.uuids != nil && time.Since(statusCache.fetched) < StatusCacheTTL {
+		return statusCache.uuids, nil
+	}
+	uuids, err := StatusSource.RunningMachines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statusCache.uuids = uuids
+	statusCache.fetched = time.Now()
+	return uuids, nil
+}
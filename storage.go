@@ -0,0 +1,315 @@
+package virtualbox
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+type StorageController struct {
+	Name        string
+	Type        string // controller chipset, such as AHCI or PIIX4
+	PortCount   int    `json:",omitempty"`
+	HostIOCache bool   `json:",omitempty"`
+	Bootable    bool   `json:",omitempty"`
+	Devices     []AttachedDevice
+}
+
+type AttachedDevice struct {
+	Type          string // HardDisk, DVD or Floppy
+	Port          int
+	Device        int
+	Medium        *uuid.UUID `json:",omitempty"`
+	NonRotational bool       `json:",omitempty"`
+	Discard       bool       `json:",omitempty"`
+	HotPluggable  bool       `json:",omitempty"`
+}
+
+type xmlAttachedDevice struct {
+	Type          string          `xml:"type,attr"`
+	Port          int             `xml:"port,attr"`
+	Device        int             `xml:"device,attr"`
+	NonRotational bool            `xml:"nonrotational,attr"`
+	Discard       bool            `xml:"discard,attr"`
+	HotPluggable  bool            `xml:"hotpluggable,attr"`
+	Image         xmlAttachedDisk `xml:"Image"`
+}
+
+type xmlStorageController struct {
+	Name        string              `xml:"name,attr"`
+	Type        string              `xml:"type,attr"`
+	PortCount   int                 `xml:"PortCount,attr"`
+	HostIOCache bool                `xml:"useHostIOCache,attr"`
+	Bootable    bool                `xml:"Bootable,attr"`
+	Devices     []xmlAttachedDevice `xml:"AttachedDevice"`
+}
+
+func (xmlController *xmlStorageController) controller() (*StorageController, error) {
+	controller := &StorageController{
+		Name:        xmlController.Name,
+		Type:        xmlController.Type,
+		PortCount:   xmlController.PortCount,
+		HostIOCache: xmlController.HostIOCache,
+		Bootable:    xmlController.Bootable,
+	}
+	for _, xmlDevice := range xmlController.Devices {
+		device := AttachedDevice{
+			Type:          xmlDevice.Type,
+			Port:          xmlDevice.Port,
+			Device:        xmlDevice.Device,
+			NonRotational: xmlDevice.NonRotational,
+			Discard:       xmlDevice.Discard,
+			HotPluggable:  xmlDevice.HotPluggable,
+		}
+		if xmlDevice.Image.UUID != "" {
+			medium, err := uuid.ParseHex(xmlDevice.Image.UUID)
+			if err != nil {
+				return nil, err
+			}
+			device.Medium = medium
+		}
+		controller.Devices = append(controller.Devices, device)
+	}
+	return controller, nil
+}
+
+// Get the named storage controller.
+func (machine *Machine) StorageController(name string) *StorageController {
+	for _, controller := range machine.StorageControllers {
+		if controller.Name == name {
+			return controller
+		}
+	}
+	return nil
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
+
+// Enable or disable the host I/O cache for a storage controller. Disabling
+// it avoids double caching for differencing disk heavy workloads.
+func (machine *Machine) SetHostIOCache(controller string, enabled bool) error {
+	_, err := machine.manage(context.Background(), "storagectl",
+		machine.UUID.String(), "--name", controller, "--hostiocache", onOff(enabled))
+	if err != nil {
+		return err
+	}
+	if c := machine.StorageController(controller); c != nil {
+		c.HostIOCache = enabled
+	}
+	return nil
+}
+
+// Options of an attached disk.
+type DiskOptions struct {
+	NonRotational bool // report the disk to the guest as an SSD
+	Discard       bool // pass TRIM from the guest through to shrink the image
+}
+
+// Change the options of the disk attached at the given controller port and
+// device.
+func (machine *Machine) SetDiskOptions(controller string, port, device int, options DiskOptions) error {
+	_, err := machine.manage(context.Background(), "storageattach",
+		machine.UUID.String(), "--storagectl", controller,
+		"--port", strconv.Itoa(port), "--device", strconv.Itoa(device),
+		"--nonrotational", onOff(options.NonRotational),
+		"--discard", onOff(options.Discard))
+	if err != nil {
+		return err
+	}
+	if c := machine.StorageController(controller); c != nil {
+		for index := range c.Devices {
+			if c.Devices[index].Port == port && c.Devices[index].Device == device {
+				c.Devices[index].NonRotational = options.NonRotational
+				c.Devices[index].Discard = options.Discard
+			}
+		}
+	}
+	return nil
+}
+
+// The bus of a storage controller, as given to storagectl --add.
+type StorageBus string
+
+const (
+	BusIDE    = StorageBus("ide")
+	BusSATA   = StorageBus("sata")
+	BusSCSI   = StorageBus("scsi")
+	BusFloppy = StorageBus("floppy")
+	BusSAS    = StorageBus("sas")
+	BusUSB    = StorageBus("usb")
+	BusPCIe   = StorageBus("pcie")
+	BusVirtio = StorageBus("virtio")
+)
+
+// The controller chipset VirtualBox picks for each bus by default.
+var defaultControllerTypes = map[StorageBus]string{
+	BusIDE:    "PIIX4",
+	BusSATA:   "AHCI",
+	BusSCSI:   "LsiLogic",
+	BusFloppy: "I82078",
+	BusSAS:    "LsiLogicSas",
+	BusUSB:    "USB",
+	BusPCIe:   "NVMe",
+	BusVirtio: "VirtioSCSI",
+}
+
+// The kind of device a medium is attached as, as given to storageattach
+// --type.
+type DeviceType string
+
+const (
+	DeviceHardDisk = DeviceType("hdd")
+	DeviceDVD      = DeviceType("dvddrive")
+	DeviceFloppy   = DeviceType("fdd")
+)
+
+// The AttachedDevice type names used in the machine XML.
+var attachedDeviceTypes = map[DeviceType]string{
+	DeviceHardDisk: "HardDisk",
+	DeviceDVD:      "DVD",
+	DeviceFloppy:   "Floppy",
+}
+
+// Add a storage controller on the given bus.
+func (machine *Machine) CreateStorageController(name string, bus StorageBus) (*StorageController, error) {
+	_, err := machine.manage(context.Background(), "storagectl",
+		machine.UUID.String(), "--name", name, "--add", string(bus))
+	if err != nil {
+		return nil, err
+	}
+	controller := &StorageController{
+		Name:     name,
+		Type:     defaultControllerTypes[bus],
+		Bootable: true,
+	}
+	machine.StorageControllers = append(machine.StorageControllers, controller)
+	return controller, nil
+}
+
+// Attach the disk at the given controller port and device, replacing what
+// was attached there. A nil disk removes the attachment.
+func (machine *Machine) AttachDisk(controller string, port, device int, disk *HardDisk, mediumType DeviceType) error {
+	medium := "none"
+	if disk != nil {
+		medium = disk.UUID.String()
+	}
+	_, err := machine.manage(context.Background(), "storageattach",
+		machine.UUID.String(), "--storagectl", controller,
+		"--port", strconv.Itoa(port), "--device", strconv.Itoa(device),
+		"--type", string(mediumType), "--medium", medium)
+	if err != nil {
+		return err
+	}
+	machine.recordAttachment(controller, port, device, disk, mediumType)
+	return nil
+}
+
+// Attach the disk image at the location as a hard disk, registering it
+// under the UUID stored in the image if it is not yet known. The disk is
+// added to the maps, and an image whose UUID is already registered for
+// another file is refused.
+func (vbox *VirtualBox) AttachDiskFile(machine *Machine, controller string, port, device int, location string) (*HardDisk, error) {
+	location, err := filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+	vbox.mutex.RLock()
+	var disk *HardDisk
+	for _, known := range vbox.HardDisks {
+		if known.Location == location {
+			disk = known
+		}
+	}
+	vbox.mutex.RUnlock()
+	if disk != nil {
+		return disk, machine.AttachDisk(controller, port, device, disk, DeviceHardDisk)
+	}
+
+	bytes, err := vboxManage("showmediuminfo", "disk", location)
+	if err != nil {
+		return nil, err
+	}
+	disks, err := parseListedHardDisks(string(bytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(disks) != 1 {
+		return nil, fmt.Errorf("virtualbox: no disk image found at %s", location)
+	}
+	for _, found := range disks {
+		disk = found
+	}
+	vbox.mutex.RLock()
+	registered := vbox.HardDisks[disk.UUID]
+	vbox.mutex.RUnlock()
+	if registered != nil && registered.Location != disk.Location {
+		return nil, fmt.Errorf("virtualbox: UUID %s of %s is already used by %s",
+			disk.UUID.String(), location, registered.Location)
+	}
+
+	_, err = machine.manage(context.Background(), "storageattach",
+		machine.UUID.String(), "--storagectl", controller,
+		"--port", strconv.Itoa(port), "--device", strconv.Itoa(device),
+		"--type", string(DeviceHardDisk), "--medium", location)
+	if err != nil {
+		return nil, err
+	}
+	machine.recordAttachment(controller, port, device, disk, DeviceHardDisk)
+
+	vbox.mutex.Lock()
+	defer vbox.mutex.Unlock()
+	if vbox.HardDisks == nil {
+		vbox.HardDisks = make(HardDiskMap)
+	}
+	vbox.HardDisks[disk.UUID] = disk
+	if disk.Parent != nil {
+		if parent := vbox.HardDisks[*disk.Parent]; parent != nil {
+			parent.Children = append(parent.Children, &disk.UUID)
+		}
+	}
+	return disk, nil
+}
+
+// Update our copy of the storage controllers after attaching a disk.
+func (machine *Machine) recordAttachment(controller string, port, device int, disk *HardDisk, mediumType DeviceType) {
+	c := machine.StorageController(controller)
+	if c == nil {
+		return
+	}
+	devices := c.Devices[:0]
+	for _, attached := range c.Devices {
+		if attached.Port != port || attached.Device != device {
+			devices = append(devices, attached)
+		}
+	}
+	c.Devices = devices
+	if disk != nil {
+		c.Devices = append(c.Devices, AttachedDevice{
+			Type:   attachedDeviceTypes[mediumType],
+			Port:   port,
+			Device: device,
+			Medium: &disk.UUID,
+		})
+	}
+	machine.refreshHardDisks()
+}
+
+// Derive the attached disks from the storage controllers.
+func (machine *Machine) refreshHardDisks() {
+	machine.HardDisks = make([]*uuid.UUID, 0)
+	for _, controller := range machine.StorageControllers {
+		for _, device := range controller.Devices {
+			if device.Medium != nil {
+				machine.HardDisks = append(machine.HardDisks, device.Medium)
+			}
+		}
+	}
+}
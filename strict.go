@@ -0,0 +1,126 @@
+package virtualbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// When set, Decode and LoadMachine fail on settings files this package may
+// not understand, such as a newer settings format, unknown values of
+// attributes that are parsed into Machine or missing required elements,
+// instead of leaving the affected fields zero.
+var Strict bool
+
+// The newest minor version of the 1.x settings format known to parse
+// correctly, as written by VirtualBox 7.1.
+var KnownSettingsVersion = 20
+
+type StrictError struct {
+	Source   string
+	Problems []string
+}
+
+func (e *StrictError) Error() string {
+	return fmt.Sprintf("virtualbox: strict decoding of %s failed: %s",
+		e.Source, strings.Join(e.Problems, "; "))
+}
+
+var (
+	knownFirmwareTypes = []string{"", "BIOS", "EFI", "EFI32", "EFI64", "EFIDUAL"}
+	knownTPMTypes      = []string{"", "None", "v1_2", "v2_0", "Host", "Swtpm"}
+	knownChipsets      = []string{"", "PIIX3", "ICH9", "ARMv8Virtual"}
+	knownFrontends     = []string{"", "gui", "headless", "sdl", "separate", "default"}
+	knownDiskFormats   = []string{"VDI", "VMDK", "VHD", "VHDX", "Parallels", "QED", "QCOW", "DMG", "RAW", "iSCSI"}
+	knownDeviceTypes   = []string{"HardDisk", "DVD", "Floppy"}
+)
+
+func knownValue(known []string, value string) bool {
+	for _, candidate := range known {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse the minor version from a settings version such as "1.19-linux".
+func settingsMinorVersion(version string) (int, bool) {
+	version, _, _ = strings.Cut(version, "-")
+	major, minor, found := strings.Cut(version, ".")
+	if !found || major != "1" {
+		return 0, false
+	}
+	number, err := strconv.Atoi(minor)
+	return number, err == nil
+}
+
+// Check the machine settings for anything Strict mode rejects.
+func (root *xmlMachineRoot) validate(source string) error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if minor, ok := settingsMinorVersion(root.Version); !ok {
+		problem("unrecognized settings version %q", root.Version)
+	} else if minor > KnownSettingsVersion {
+		problem("settings version %s is newer than 1.%d", root.Version, KnownSettingsVersion)
+	}
+
+	for _, machine := range root.Machines {
+		if machine.Name == "" {
+			problem("missing machine name")
+		}
+		if machine.Hardware.Memory.RAMSize == 0 {
+			problem("missing Hardware>Memory")
+		}
+		if !knownValue(knownFirmwareTypes, machine.Hardware.Firmware.Type) {
+			problem("unknown firmware type %q", machine.Hardware.Firmware.Type)
+		}
+		if !knownValue(knownTPMTypes, machine.Hardware.TPM.Type) {
+			problem("unknown TPM type %q", machine.Hardware.TPM.Type)
+		}
+		for _, chipset := range []string{machine.Hardware.Chipset.Type, machine.Hardware.Platform.Chipset.Type} {
+			if !knownValue(knownChipsets, chipset) {
+				problem("unknown chipset %q", chipset)
+			}
+		}
+		if !knownValue(knownFrontends, string(machine.Hardware.Frontend.Type)) {
+			problem("unknown frontend %q", machine.Hardware.Frontend.Type)
+		}
+		for _, adapter := range machine.Hardware.NetworkAdapters {
+			if adapter.NAT == nil {
+				continue
+			}
+			for _, forwarding := range adapter.NAT.Forwarding {
+				if forwarding.Protocol != 0 && forwarding.Protocol != 1 {
+					problem("unknown protocol %d in forwarding rule %q",
+						forwarding.Protocol, forwarding.Name)
+				}
+			}
+		}
+		var disks []xmlHardDisk
+		disks = append(disks, machine.MediaRegistry.HardDisks...)
+		for len(disks) != 0 {
+			disk := disks[0]
+			disks = append(disks[1:], disk.Children...)
+			if !knownValue(knownDiskFormats, string(disk.Format)) {
+				problem("unknown format %q of disk %s", disk.Format, disk.Location)
+			}
+		}
+		for _, controller := range machine.StorageControllers {
+			for _, device := range controller.Devices {
+				if !knownValue(knownDeviceTypes, device.Type) {
+					problem("unknown device type %q on controller %q",
+						device.Type, controller.Name)
+				}
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return &StrictError{Source: source, Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package virtualbox
+
+import (
+	"strconv"
+)
+
+type ProxyMode string
+
+const (
+	ProxySystem = ProxyMode("system")
+	ProxyNone   = ProxyMode("noproxy")
+	ProxyManual = ProxyMode("manual")
+)
+
+// Global VirtualBox settings, as stored in VirtualBox.xml.
+type SystemProperties struct {
+	MachineFolder         string         `json:",omitempty"`
+	DefaultHardDiskFormat HardDiskFormat `json:",omitempty"`
+	VRDEAuthLibrary       string         `json:",omitempty"`
+	DefaultFrontend       Frontend       `json:",omitempty"`
+	AutostartDBPath       string         `json:",omitempty"`
+	ProxyMode             ProxyMode      `json:",omitempty"`
+	ProxyURL              string         `json:",omitempty"`
+	LogHistoryCount       int            `json:",omitempty"`
+}
+
+type xmlSystemProperties struct {
+	MachineFolder         string         `xml:"defaultMachineFolder,attr"`
+	DefaultHardDiskFormat HardDiskFormat `xml:"defaultHardDiskFormat,attr"`
+	VRDEAuthLibrary       string         `xml:"VRDEAuthLibrary,attr"`
+	DefaultFrontend       Frontend       `xml:"defaultFrontend,attr"`
+	AutostartDBPath       string         `xml:"autostartDatabasePath,attr"`
+	ProxyMode             int            `xml:"proxyMode,attr"`
+	ProxyURL              string         `xml:"proxyUrl,attr"`
+	LogHistoryCount       int            `xml:"LogHistoryCount,attr"`
+}
+
+// The proxyMode attribute stores the mode as an index.
+var xmlProxyModes = []ProxyMode{ProxySystem, ProxyNone, ProxyManual}
+
+func (xmlProperties *xmlSystemProperties) properties() SystemProperties {
+	properties := SystemProperties{
+		MachineFolder:         xmlProperties.MachineFolder,
+		DefaultHardDiskFormat: xmlProperties.DefaultHardDiskFormat,
+		VRDEAuthLibrary:       xmlProperties.VRDEAuthLibrary,
+		DefaultFrontend:       xmlProperties.DefaultFrontend,
+		AutostartDBPath:       xmlProperties.AutostartDBPath,
+		ProxyURL:              xmlProperties.ProxyURL,
+		LogHistoryCount:       xmlProperties.LogHistoryCount,
+	}
+	if xmlProperties.ProxyMode >= 0 && xmlProperties.ProxyMode < len(xmlProxyModes) {
+		properties.ProxyMode = xmlProxyModes[xmlProperties.ProxyMode]
+	}
+	return properties
+}
+
+// Set a global property with "VBoxManage setproperty".
+func SetSystemProperty(name, value string) error {
+	_, err := vboxManageModify("setproperty", name, value)
+	return err
+}
+
+// Set the proxy used for update checks and extension pack downloads. The
+// URL is only used with ProxyManual.
+func SetProxy(mode ProxyMode, url string) error {
+	err := SetSystemProperty("proxymode", string(mode))
+	if err != nil {
+		return err
+	}
+	if mode == ProxyManual {
+		return SetSystemProperty("proxyurl", url)
+	}
+	return nil
+}
+
+// Set the frontend used when starting machines without an explicit type.
+func SetDefaultFrontend(frontend Frontend) error {
+	return SetSystemProperty("defaultfrontend", string(frontend))
+}
+
+// Set the directory holding the autostart database.
+func SetAutostartDBPath(dir string) error {
+	return SetSystemProperty("autostartdbpath", dir)
+}
+
+// Set the folder new machines are created in by default.
+func SetMachineFolder(dir string) error {
+	return SetSystemProperty("machinefolder", dir)
+}
+
+// Enable or disable the periodic update check, checking every given number
+// of days. Requires VirtualBox 7.
+func SetUpdateCheck(enabled bool, days int) error {
+	args := []string{"updatecheck", "modify"}
+	if enabled {
+		args = append(args, "--enable", "--frequency", strconv.Itoa(days))
+	} else {
+		args = append(args, "--disable")
+	}
+	_, err := vboxManageModify(args...)
+	return err
+}
+
+// Apply every non zero property, so that hosts can be configured uniformly
+// from a single description.
+func (properties *SystemProperties) Apply() error {
+	values := []struct{ name, value string }{
+		{"machinefolder", properties.MachineFolder},
+		{"vrdeauthlibrary", properties.VRDEAuthLibrary},
+		{"defaultfrontend", string(properties.DefaultFrontend)},
+		{"autostartdbpath", properties.AutostartDBPath},
+		{"proxymode", string(properties.ProxyMode)},
+		{"proxyurl", properties.ProxyURL},
+	}
+	if properties.LogHistoryCount != 0 {
+		values = append(values, struct{ name, value string }{
+			"loghistorycount", strconv.Itoa(properties.LogHistoryCount)})
+	}
+	for _, value := range values {
+		if value.value == "" {
+			continue
+		}
+		err := SetSystemProperty(value.name, value.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// The extra data item holding the comma separated tags of a machine.
+const tagsExtraData = "tags"
+
+type xmlExtraDataItem struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Split the value of the tags extra data item.
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (machine *Machine) hasTag(tag string) bool {
+	for _, machineTag := range machine.Tags {
+		if machineTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Set the tags of the machine, kept in its extra data for tools grouping
+// machines, such as the Ansible inventory. No tags removes the item.
+func (machine *Machine) SetTags(tags ...string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ",") {
+			return errors.New("virtualbox: invalid tag " + strconv.Quote(tag))
+		}
+	}
+	args := []string{"setextradata", machine.UUID.String(), tagsExtraData}
+	if len(tags) != 0 {
+		args = append(args, strings.Join(tags, ","))
+	}
+	_, err := machine.manage(context.Background(), args...)
+	if err != nil {
+		return err
+	}
+	machine.Tags = append([]string(nil), tags...)
+	return nil
+}
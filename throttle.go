@@ -0,0 +1,229 @@
+package virtualbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduling priority for medium heavy operations. Zero values leave the
+// respective priority unchanged.
+type IOPriority struct {
+	Nice    int // niceness adjustment applied with nice(1)
+	IOClass int // ionice(1) class: 1 realtime, 2 best effort, 3 idle
+	IOLevel int // ionice(1) level from 0 to 7 for the realtime and best effort classes
+}
+
+// Priority applied to medium heavy VBoxManage operations such as cloning,
+// compacting, converting, importing and exporting disks. The nice and
+// ionice commands are only used where they are installed.
+var MediumPriority IOPriority
+
+var (
+	mediumSlotsMutex sync.Mutex
+	mediumSlots      chan struct{}
+)
+
+// Limit the number of medium heavy operations, including checksumming of
+// appliances, running at once across the process. Zero or less removes the
+// limit. Operations already running are not affected.
+func SetMediumConcurrency(n int) {
+	mediumSlotsMutex.Lock()
+	defer mediumSlotsMutex.Unlock()
+	if n <= 0 {
+		mediumSlots = nil
+	} else {
+		mediumSlots = make(chan struct{}, n)
+	}
+}
+
+func noopRelease() {}
+
+// Wait for a free medium operation slot, returning the function to release
+// it.
+func acquireMediumSlot(ctx context.Context) (release func(), err error) {
+	mediumSlotsMutex.Lock()
+	slots := mediumSlots
+	mediumSlotsMutex.Unlock()
+	if slots == nil {
+		return noopRelease, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Get the wrapper command applying the priority.
+func (priority IOPriority) wrapper() (wrapper []string) {
+	if priority.Nice != 0 {
+		if _, err := exec.LookPath("nice"); err == nil {
+			wrapper = append(wrapper, "nice", "-n", strconv.Itoa(priority.Nice))
+		}
+	}
+	if priority.IOClass != 0 {
+		if _, err := exec.LookPath("ionice"); err == nil {
+			wrapper = append(wrapper, "ionice", "-c", strconv.Itoa(priority.IOClass))
+			if priority.IOClass != 3 {
+				wrapper = append(wrapper, "-n", strconv.Itoa(priority.IOLevel))
+			}
+		}
+	}
+	return
+}
+
+// Run a medium heavy VBoxManage command that changes hypervisor state,
+// waiting for a free slot and applying MediumPriority.
+func vboxManageMediumContext(ctx context.Context, args ...string) ([]byte, error) {
+	if ReadOnly {
+		return nil, ErrReadOnly
+	}
+	release, err := acquireMediumSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return runVBoxManage(ctx, MediumPriority.wrapper(), args)
+}
+
+var (
+	commandMutex     sync.Mutex
+	commandSlots     chan struct{}
+	commandInterval  time.Duration
+	commandNextStart time.Time
+)
+
+// Limit the number of VBoxManage processes running at once across the
+// process, so bursts of queries from many goroutines do not overwhelm
+// VBoxSVC. Zero or less removes the limit.
+func SetCommandConcurrency(n int) {
+	commandMutex.Lock()
+	defer commandMutex.Unlock()
+	if n <= 0 {
+		commandSlots = nil
+	} else {
+		commandSlots = make(chan struct{}, n)
+	}
+}
+
+// Limit how many VBoxManage processes are started per second. Zero or less
+// removes the limit.
+func SetCommandRate(perSecond int) {
+	commandMutex.Lock()
+	defer commandMutex.Unlock()
+	if perSecond <= 0 {
+		commandInterval = 0
+	} else {
+		commandInterval = time.Second / time.Duration(perSecond)
+	}
+}
+
+// Wait for a free command slot and for the rate limit to allow another
+// process, returning the function to release the slot.
+func acquireCommandSlot(ctx context.Context) (release func(), err error) {
+	commandMutex.Lock()
+	slots := commandSlots
+	commandMutex.Unlock()
+	release = noopRelease
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			release = func() { <-slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	commandMutex.Lock()
+	now := time.Now()
+	start := now
+	if commandInterval != 0 {
+		if commandNextStart.After(now) {
+			start = commandNextStart
+		}
+		commandNextStart = start.Add(commandInterval)
+	}
+	commandMutex.Unlock()
+	if wait := start.Sub(now); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// Subcommands that only read state, which are safe to share between callers.
+var querySubcommands = map[string]bool{
+	"showvminfo":     true,
+	"list":           true,
+	"showmediuminfo": true,
+	"showhdinfo":     true,
+	"getextradata":   true,
+}
+
+func isQuery(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "guestproperty" && len(args) > 1 {
+		return args[1] == "get" || args[1] == "enumerate"
+	}
+	return querySubcommands[args[0]]
+}
+
+type sharedQuery struct {
+	done  chan struct{}
+	bytes []byte
+	err   error
+	ctx   context.Context
+}
+
+var (
+	sharedQueriesMutex sync.Mutex
+	sharedQueries      = make(map[string]*sharedQuery)
+)
+
+// Run a query, or wait for the identical one already running and use its
+// output. Callers whose shared query was cancelled by the context of the
+// caller that started it run the query themselves.
+func runSharedQuery(ctx context.Context, wrapper []string, args []string) ([]byte, error) {
+	key := strings.Join(append(append([]string{RunAs, os.Getenv("VBOX_USER_HOME")},
+		wrapper...), args...), "\x00")
+
+	sharedQueriesMutex.Lock()
+	query := sharedQueries[key]
+	if query == nil {
+		query = &sharedQuery{done: make(chan struct{}), ctx: ctx}
+		sharedQueries[key] = query
+		sharedQueriesMutex.Unlock()
+
+		query.bytes, query.err = runLimited(ctx, wrapper, args)
+		sharedQueriesMutex.Lock()
+		delete(sharedQueries, key)
+		sharedQueriesMutex.Unlock()
+		close(query.done)
+		return query.bytes, query.err
+	}
+	sharedQueriesMutex.Unlock()
+
+	select {
+	case <-query.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if query.err != nil && query.ctx.Err() != nil && ctx.Err() == nil {
+		return runLimited(ctx, wrapper, args)
+	}
+	return append([]byte(nil), query.bytes...), query.err
+}
@@ -0,0 +1,116 @@
+package virtualbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timeSyncPropertyPrefix = "/VirtualBox/GuestAdd/VBoxService/--timesync-"
+
+// Guest Additions time synchronization parameters. Zero values leave the
+// guest default in place.
+type TimeSync struct {
+	Interval      time.Duration // how often to synchronize
+	MinAdjust     time.Duration // smallest drift worth adjusting
+	LatencyFactor int           // multiple of the host query latency to tolerate
+	MaxLatency    time.Duration // ignore host queries slower than this
+	SetThreshold  time.Duration // drift beyond which the clock is set, not slewed
+	SetStart      bool          // set the clock when VBoxService starts
+	SetOnRestore  *bool         // set the clock after restoring a saved state, on by default
+}
+
+// Set a VBoxService time sync guest property, where an empty value removes it.
+func (machine *Machine) setTimeSyncProperty(name, value string) error {
+	args := []string{"guestproperty", "set", machine.UUID.String(),
+		timeSyncPropertyPrefix + name}
+	if value != "" {
+		args = append(args, value)
+	}
+	_, err := machine.manage(context.Background(), args...)
+	return err
+}
+
+func milliseconds(duration time.Duration) string {
+	if duration == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(duration/time.Millisecond), 10)
+}
+
+// Configure the Guest Additions time synchronization. The guest picks up
+// the settings when VBoxService next starts.
+func (machine *Machine) SetTimeSync(settings TimeSync) error {
+	latencyFactor := ""
+	if settings.LatencyFactor != 0 {
+		latencyFactor = strconv.Itoa(settings.LatencyFactor)
+	}
+	setStart := ""
+	if settings.SetStart {
+		setStart = "1"
+	}
+	setOnRestore := ""
+	if settings.SetOnRestore != nil {
+		setOnRestore = "0"
+		if *settings.SetOnRestore {
+			setOnRestore = "1"
+		}
+	}
+	values := []struct{ name, value string }{
+		{"interval", milliseconds(settings.Interval)},
+		{"min-adjust", milliseconds(settings.MinAdjust)},
+		{"latency-factor", latencyFactor},
+		{"max-latency", milliseconds(settings.MaxLatency)},
+		{"set-threshold", milliseconds(settings.SetThreshold)},
+		{"set-start", setStart},
+		{"set-on-restore", setOnRestore},
+	}
+	for _, value := range values {
+		err := machine.setTimeSyncProperty(value.name, value.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop the guest from reading the host clock, which is needed for tests that
+// run the guest at a different time than the host.
+func (machine *Machine) SetHostTimeSyncDisabled(disabled bool) error {
+	value := "0"
+	if disabled {
+		value = "1"
+	}
+	_, err := machine.manage(context.Background(), "setextradata", machine.UUID.String(),
+		"VBoxInternal/Devices/VMMDev/0/Config/GetHostTimeDisabled", value)
+	return err
+}
+
+// Set the guest clock by typing a command on the guest console, for guests
+// without Guest Additions. The format is given the host time as Unix
+// seconds, for example "date -u -s @%d", and must be accepted by whatever
+// is focused on the console, typically a root shell.
+func (machine *Machine) KeyboardSetTime(format string) error {
+	command := fmt.Sprintf(format, time.Now().Unix()) + "\n"
+	return machine.controlVM("keyboardputstring", command)
+}
+
+// Measure how far the guest clock is ahead of the host clock by running date
+// in the guest through guest control. Assumes a POSIX guest.
+func (machine *Machine) GuestClockSkew(ctx context.Context, creds GuestCredentials) (time.Duration, error) {
+	before := time.Now()
+	bytes, err := machine.guestRun(ctx, creds, "/bin/date", "-u", "+%s%N")
+	if err != nil {
+		return 0, err
+	}
+	after := time.Now()
+
+	nanoseconds, err := strconv.ParseInt(strings.TrimSpace(string(bytes)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("virtualbox: unexpected guest date output %q", bytes)
+	}
+	hostMidpoint := before.Add(after.Sub(before) / 2)
+	return time.Unix(0, nanoseconds).Sub(hostMidpoint), nil
+}
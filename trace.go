@@ -0,0 +1,53 @@
+package virtualbox
+
+import (
+	"context"
+)
+
+// Attribute keys used on spans.
+const (
+	TraceCommand = "vbox.command"
+	TraceUUID    = "vbox.uuid"
+	TracePath    = "vbox.path"
+)
+
+// Receives a span for every VBoxManage invocation and decoding step. The
+// returned context carries the span so nested operations become children,
+// and the returned function ends the span with the operation's error. An
+// adapter for OpenTelemetry or any other tracing system only needs to
+// implement this method.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, func(err error))
+}
+
+// The tracer used for all operations, nil to disable tracing.
+var Trace Tracer
+
+func noopEndSpan(error) {}
+
+func startSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, func(err error)) {
+	if Trace == nil {
+		return ctx, noopEndSpan
+	}
+	return Trace.StartSpan(ctx, name, attributes)
+}
+
+// Get the span attributes for a VBoxManage invocation, including the first
+// UUID in the arguments, which identifies the machine or medium operated on.
+// Without a tracer there are none.
+func commandAttributes(args []string) map[string]string {
+	if Trace == nil {
+		return nil
+	}
+	attributes := make(map[string]string, 2)
+	if len(args) != 0 {
+		attributes[TraceCommand] = args[0]
+	}
+	for _, arg := range args {
+		if uuids := extractUUIDs(arg); len(uuids) != 0 {
+			attributes[TraceUUID] = uuids[0].String()
+			break
+		}
+	}
+	return attributes
+}
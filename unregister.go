@@ -0,0 +1,80 @@
+package virtualbox
+
+import (
+	"context"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Unregister the machine, also deleting its settings, saved states, logs
+// and attached disk images if deleteFiles is set. The machine must be off.
+func (machine *Machine) Unregister(deleteFiles bool) error {
+	return machine.UnregisterContext(context.Background(), deleteFiles)
+}
+
+// Unregister the machine, killing VBoxManage if the context is done first.
+func (machine *Machine) UnregisterContext(ctx context.Context, deleteFiles bool) error {
+	args := []string{"unregistervm", machine.UUID.String()}
+	if deleteFiles {
+		args = append(args, "--delete")
+	}
+	_, err := machine.manageMedium(ctx, args...)
+	return err
+}
+
+// Get the disks the machine uses, which are its attached disks and their
+// parents.
+func (vbox *VirtualBox) usedHardDisks(machine *Machine) map[uuid.UUID]bool {
+	used := make(map[uuid.UUID]bool)
+	for _, attached := range machine.HardDisks {
+		for disk := vbox.HardDisks[*attached]; disk != nil && !used[disk.UUID]; {
+			used[disk.UUID] = true
+			if disk.Parent == nil {
+				break
+			}
+			disk = vbox.HardDisks[*disk.Parent]
+		}
+	}
+	return used
+}
+
+// Get the disks the machine uses that no other machine uses.
+func (vbox *VirtualBox) exclusiveHardDisks(machine *Machine) map[uuid.UUID]bool {
+	used := vbox.usedHardDisks(machine)
+	for _, other := range vbox.Machines {
+		if other.UUID == machine.UUID {
+			continue
+		}
+		for diskUUID := range vbox.usedHardDisks(other) {
+			delete(used, diskUUID)
+		}
+	}
+	return used
+}
+
+// Unregister the machine like Machine.Unregister and remove it from the
+// maps, along with the disks it used that no other machine uses.
+func (vbox *VirtualBox) Unregister(machine *Machine, deleteFiles bool) error {
+	err := machine.Unregister(deleteFiles)
+	if err != nil {
+		return err
+	}
+	vbox.mutex.Lock()
+	defer vbox.mutex.Unlock()
+	used := vbox.exclusiveHardDisks(machine)
+	delete(vbox.Machines, machine.UUID)
+	for diskUUID := range used {
+		delete(vbox.HardDisks, diskUUID)
+	}
+	// differencing images of the machine hang off base images kept for others
+	for _, disk := range vbox.HardDisks {
+		var children []*uuid.UUID
+		for _, child := range disk.Children {
+			if !used[*child] {
+				children = append(children, child)
+			}
+		}
+		disk.Children = children
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package virtualbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// Returned by operations that would change hypervisor state while ReadOnly
+// is set.
+var ErrReadOnly = errors.New("virtualbox: operation not permitted in read-only mode")
+
+// When set, every mutating operation returns ErrReadOnly without invoking
+// VBoxManage. Inventory and monitoring tools can set this to guarantee they
+// never change hypervisor state.
+var ReadOnly bool
+
+// The environment VBoxManage and the other tools are run with, in the
+// key=value form of os.Environ. Nil inherits the environment of the
+// process. VBOX_USER_HOME is always passed on from the process environment,
+// where SetHome puts it.
+var CommandEnv []string
+
+// The locale the tools are run in, set as LC_ALL so that VBoxManage prints
+// the untranslated messages the output parsing expects. Empty leaves the
+// locale alone.
+var CommandLocale = "C"
+
+// Get the environment for a child process from CommandEnv, CommandLocale
+// and VBOX_USER_HOME.
+func commandEnv() []string {
+	env := CommandEnv
+	if env == nil {
+		env = os.Environ()
+	}
+	overrides := make(map[string]string)
+	if home, found := os.LookupEnv("VBOX_USER_HOME"); found {
+		overrides["VBOX_USER_HOME"] = home
+	}
+	if CommandLocale != "" {
+		overrides["LC_ALL"] = CommandLocale
+		// dropped, as it takes precedence over LC_ALL for translated messages
+		overrides["LANGUAGE"] = ""
+	}
+	result := make([]string, 0, len(env)+len(overrides))
+	for _, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		if _, found := overrides[key]; !found {
+			result = append(result, entry)
+		}
+	}
+	for _, key := range []string{"VBOX_USER_HOME", "LC_ALL"} {
+		if value, found := overrides[key]; found {
+			result = append(result, key+"="+value)
+		}
+	}
+	return result
+}
+
+// Build a command running in the environment from commandEnv.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	command := exec.CommandContext(ctx, name, args...)
+	command.Env = commandEnv()
+	return command
+}
+
+// Create an empty temporary file for VBoxManage to read or write, returning
+// its name and the function removing it. The file is private to the user,
+// except with RunAs, where the sudo user needs to use it too: it is then
+// world writable, but in a directory that cannot be listed, so only those
+// knowing its random name can find it.
+func commandTempFile(pattern string) (name string, remove func(), err error) {
+	dir, err := os.MkdirTemp("", "vbox-")
+	if err != nil {
+		return "", nil, err
+	}
+	remove = func() { os.RemoveAll(dir) }
+	file, err := os.CreateTemp(dir, pattern)
+	if err == nil {
+		err = file.Close()
+	}
+	if err == nil && RunAs != "" {
+		err = os.Chmod(dir, 0711)
+		if err == nil {
+			err = os.Chmod(file.Name(), 0666)
+		}
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	return file.Name(), remove, nil
+}
+
+// Build the VBoxManage command, going through sudo when RunAs is set. The
+// wrapper is a command such as nice that is given VBoxManage to run.
+func vboxManageCommand(ctx context.Context, wrapper []string, args ...string) *exec.Cmd {
+	command := append(append([]string{}, wrapper...), "VBoxManage")
+	command = append(command, args...)
+	if RunAs != "" {
+		sudo := []string{"sudo", "-n", "-u", RunAs, "env"}
+		if home := os.Getenv("VBOX_USER_HOME"); home != "" {
+			sudo = append(sudo, "VBOX_USER_HOME="+home)
+		}
+		if CommandLocale != "" {
+			sudo = append(sudo, "LC_ALL="+CommandLocale)
+		}
+		command = append(sudo, command...)
+	}
+	return newCommand(ctx, command[0], command[1:]...)
+}
+
+// Run VBoxManage with the given arguments and return its standard output.
+func vboxManage(args ...string) ([]byte, error) {
+	return vboxManageContext(context.Background(), args...)
+}
+
+// Run VBoxManage, killing it if the context is done before it exits.
+func vboxManageContext(ctx context.Context, args ...string) ([]byte, error) {
+	return runVBoxManage(ctx, nil, args)
+}
+
+// Run VBoxManage after waiting for the limits set by SetCommandConcurrency
+// and SetCommandRate, sharing the result of identical queries that are
+// already running.
+func runVBoxManage(ctx context.Context, wrapper []string, args []string) ([]byte, error) {
+	if isQuery(args) {
+		return runSharedQuery(ctx, wrapper, args)
+	}
+	return runLimited(ctx, wrapper, args)
+}
+
+func runLimited(ctx context.Context, wrapper []string, args []string) ([]byte, error) {
+	release, err := acquireCommandSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, endSpan := startSpan(ctx, "VBoxManage", commandAttributes(args))
+	bytes, err := vboxManageCommand(ctx, wrapper, args...).Output()
+	err = commandError(args, nil, err)
+	endSpan(err)
+	return bytes, err
+}
+
+// Run VBoxManage like vboxManageContext, also returning standard error.
+func vboxManageOutputs(ctx context.Context, args ...string) (stdout, stderr []byte, err error) {
+	release, err := acquireCommandSlot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+	ctx, endSpan := startSpan(ctx, "VBoxManage", commandAttributes(args))
+	var stdoutBuffer, stderrBuffer bytes.Buffer
+	command := vboxManageCommand(ctx, nil, args...)
+	command.Stdout, command.Stderr = &stdoutBuffer, &stderrBuffer
+	err = command.Run()
+	err = commandError(args, stderrBuffer.Bytes(), err)
+	endSpan(err)
+	return stdoutBuffer.Bytes(), stderrBuffer.Bytes(), err
+}
+
+// Run a VBoxManage command that changes hypervisor state.
+func vboxManageModify(args ...string) ([]byte, error) {
+	return vboxManageModifyContext(context.Background(), args...)
+}
+
+// Run a VBoxManage command that changes hypervisor state, killing it if the
+// context is done before it exits.
+func vboxManageModifyContext(ctx context.Context, args ...string) ([]byte, error) {
+	if ReadOnly {
+		return nil, ErrReadOnly
+	}
+	return vboxManageContext(ctx, args...)
+}
+
+// Parse the key=value output of the --machinereadable VBoxManage commands.
+func parseMachineReadable(text string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := splitMachineReadable(line)
+		if ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// Split a key=value line of --machinereadable output, removing the quotes.
+func splitMachineReadable(line string) (key, value string, ok bool) {
+	index := strings.Index(line, "=")
+	if index < 1 {
+		return "", "", false
+	}
+	key = strings.Trim(line[:index], "\"")
+	return key, strings.Trim(strings.TrimSpace(line[index+1:]), "\""), true
+}
+
+// Get the machine readable showvminfo output for the given machine.
+func showVMInfo(nameOrUUID string) (map[string]string, error) {
+	bytes, err := vboxManage("showvminfo", nameOrUUID, "--machinereadable")
+	if err != nil {
+		return nil, err
+	}
+	return parseMachineReadable(string(bytes)), nil
+}
+
+// Look up a registered machine by name or UUID using showvminfo.
+func showMachine(ctx context.Context, nameOrUUID string) (*Machine, map[string]string, error) {
+	bytes, err := vboxManageContext(ctx, "showvminfo", nameOrUUID, "--machinereadable")
+	if err != nil {
+		return nil, nil, err
+	}
+	info := parseMachineReadable(string(bytes))
+	machineUUID, err := uuid.ParseHex(info["UUID"])
+	if err != nil {
+		return nil, nil, err
+	}
+	machine := &Machine{
+		UUID:   *machineUUID,
+		Name:   info["name"],
+		Source: info["CfgFile"],
+		OSType: OSType(info["ostype"]),
+		Status: parseVMState(info["VMState"]),
+		Groups: parseInfoGroups(info),
+
+		LastStateChange: parseStateChangeTime(info["VMStateChangeTime"]),
+	}
+	return machine, info, nil
+}
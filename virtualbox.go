@@ -2,17 +2,21 @@
 package virtualbox
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	uuid "github.com/daaku/gouuid"
 	"log"
+	"net"
 	"os"
 	"os/exec"
-	"path"
+	"path/filepath"
 	"regexp"
-	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type HardDiskFormat string
@@ -28,11 +32,40 @@ const (
 	Immutable = HardDiskType("Immutable")
 )
 
+type Frontend string
+
+const (
+	GUI      = Frontend("gui")
+	Headless = Frontend("headless")
+	Separate = Frontend("separate")
+
+	// Resets the machine default frontend to the global one.
+	DefaultFrontend = Frontend("default")
+)
+
 type Status string
 
 const (
 	Off     = Status("Off")
 	Running = Status("Running")
+	Paused  = Status("Paused")
+	Saved   = Status("Saved")
+	Stuck   = Status("Stuck") // in a guru meditation
+	Aborted = Status("Aborted")
+
+	// Transitions between the states above.
+	Starting     = Status("Starting")
+	Stopping     = Status("Stopping")
+	Saving       = Status("Saving")
+	Restoring    = Status("Restoring")
+	Snapshotting = Status("Snapshotting")
+	Teleporting  = Status("Teleporting")
+	Teleported   = Status("Teleported")
+	SettingUp    = Status("SettingUp")
+
+	// The state could not be determined, for example because VBoxManage is
+	// not installed.
+	Unknown = Status("Unknown")
 )
 
 type HardDisk struct {
@@ -52,16 +85,74 @@ type Machine struct {
 	OSType       OSType
 	Status       Status `json:",omitempty"`
 	HardDisks    []*uuid.UUID
-	VRDEPort     int `json:",omitempty"`
-	SeleniumPort int `json:",omitempty"`
+	VRDEEnabled  bool     `json:",omitempty"`
+	VRDEPort     Port     `json:",omitempty"`
+	VRDE         *VRDE    `json:",omitempty"`
+	SeleniumPort Port     `json:",omitempty"`
+	CPUs         int      `json:",omitempty"`
+	CPUHotPlug   bool     `json:",omitempty"`
+	CPUCap       int      `json:",omitempty"`
+	PluggedCPUs  []int    `json:",omitempty"`
+	Memory       int      `json:",omitempty"`
+	Firmware     Firmware `json:",omitempty"`
+	TPM          TPMType  `json:",omitempty"`
+	TPMLocation  string   `json:",omitempty"`
+
+	HardwareUUID   *uuid.UUID    `json:",omitempty"` // reported to the guest when not the UUID
+	BIOSTimeOffset time.Duration `json:",omitempty"` // of the guest clock from the host clock
+	BootMenu       BootMenuMode  `json:",omitempty"`
+	BootLogo       *BootLogo     `json:",omitempty"`
+	BootOrder      []BootDevice  `json:",omitempty"`
+	Frontend       Frontend      `json:",omitempty"`
+	Forwards       []PortForward `json:",omitempty"` // of all adapters
+	Groups         []string      `json:",omitempty"`
+	Tags           []string      `json:",omitempty"`
+
+	NetworkAdapters []*NetworkAdapter `json:",omitempty"`
+
+	SettingsVersion string `json:",omitempty"`
+	LastStateChange time.Time
+	Architecture    string     `json:",omitempty"` // from VirtualBox 7.1
+	NVRAM           string     `json:",omitempty"`
+	Recording       *Recording `json:",omitempty"`
+
+	StorageControllers []*StorageController `json:",omitempty"`
+	SharedFolders      []SharedFolder       `json:",omitempty"`
+
+	Snapshots       []*Snapshot `json:",omitempty"`
+	CurrentSnapshot *uuid.UUID  `json:",omitempty"`
+
+	Chipset   Chipset `json:",omitempty"`
+	IOAPIC    bool    `json:",omitempty"`
+	HPET      bool    `json:",omitempty"`
+	RTCUseUTC bool    `json:",omitempty"`
+
+	Audio bool `json:",omitempty"` // audio is played on the host
+
+	VRAM         int           `json:",omitempty"` // megabytes
+	NestedPaging bool          `json:",omitempty"`
+	PAE          bool          `json:",omitempty"`
+	USB          USBController `json:",omitempty"`
+
+	snapshotFolder string
+	fingerprint    *settingsFingerprint
+	guestIPs       []string // last reported by the Guest Additions
 }
 
 type HardDiskMap map[uuid.UUID]*HardDisk
 type MachineMap map[uuid.UUID]*Machine
 
 type VirtualBox struct {
-	HardDisks HardDiskMap
-	Machines  MachineMap
+	HardDisks        HardDiskMap
+	DVDImages        DVDImageMap
+	FloppyImages     FloppyImageMap
+	Machines         MachineMap
+	SystemProperties SystemProperties
+
+	// serializes changes to the maps made by methods
+	mutex sync.RWMutex
+
+	diskConflicts map[uuid.UUID][]string
 }
 
 type xmlMachineListEntry struct {
@@ -70,8 +161,10 @@ type xmlMachineListEntry struct {
 }
 
 type xmlMachineList struct {
-	XMLName  xml.Name              `xml:"VirtualBox"`
-	Machines []xmlMachineListEntry `xml:"Global>MachineRegistry>MachineEntry"`
+	XMLName          xml.Name              `xml:"VirtualBox"`
+	Machines         []xmlMachineListEntry `xml:"Global>MachineRegistry>MachineEntry"`
+	MediaRegistry    xmlMediaRegistry      `xml:"Global>MediaRegistry"`
+	SystemProperties xmlSystemProperties   `xml:"Global>SystemProperties"`
 }
 
 type xmlHardDisk struct {
@@ -89,31 +182,123 @@ type xmlVrdeProperty struct {
 }
 
 type xmlRemoteDisplay struct {
-	Enabled    bool              `xml:"enabled,attr"`
-	Properties []xmlVrdeProperty `xml:"VRDEProperties>Property"`
+	Enabled         bool              `xml:"enabled,attr"`
+	AuthType        string            `xml:"authType,attr"`
+	AuthLibrary     string            `xml:"authLibrary,attr"`
+	AuthTimeout     int               `xml:"authTimeout,attr"`
+	MultiConnection bool              `xml:"allowMultiConnection,attr"`
+	Properties      []xmlVrdeProperty `xml:"VRDEProperties>Property"`
 }
 
 type xmlNetworkForwarding struct {
 	Name      string `xml:"name,attr"`
-	HostPort  int    `xml:"hostport,attr"`
-	GuestPort int    `xml:"guestport,attr"`
+	Protocol  int    `xml:"proto,attr"`
+	HostIP    string `xml:"hostip,attr"`
+	HostPort  Port   `xml:"hostport,attr"`
+	GuestIP   string `xml:"guestip,attr"`
+	GuestPort Port   `xml:"guestport,attr"`
+}
+
+type xmlAudioAdapter struct {
+	Driver     string `xml:"driver,attr"`
+	Enabled    bool   `xml:"enabled,attr"`
+	EnabledOut string `xml:"enabledOut,attr"` // missing before VirtualBox 6
+}
+
+// Check if the audio adapter plays sound on the host.
+func (audio *xmlAudioAdapter) output() bool {
+	return audio.Enabled && audio.Driver != "Null" && audio.EnabledOut != "false"
 }
 
 type xmlAttachedDisk struct {
 	UUID string `xml:"uuid,attr"`
 }
 
+type xmlCPUTreeEntry struct {
+	ID int `xml:"id,attr"`
+}
+
+type xmlCPU struct {
+	Count        int               `xml:"count,attr"`
+	HotPlug      bool              `xml:"hotplug,attr"`
+	ExecutionCap int               `xml:"executionCap,attr"`
+	Tree         []xmlCPUTreeEntry `xml:"CpuTree>Cpu"`
+	xmlCPUFeatures
+}
+
+type xmlMemory struct {
+	RAMSize int `xml:"RAMSize,attr"`
+}
+
+type xmlTimeOffset struct {
+	Value int64 `xml:"value,attr"` // milliseconds
+}
+
+type xmlFirmware struct {
+	Type       string        `xml:"type,attr"`
+	TimeOffset xmlTimeOffset `xml:"TimeOffset"` // from VirtualBox 7.1
+	Logo       xmlLogo       `xml:"Logo"`
+	BootMenu   xmlBootMenu   `xml:"BootMenu"`
+	IOAPIC     xmlEnabled    `xml:"IOAPIC"` // from VirtualBox 7.1
+}
+
+type xmlFrontend struct {
+	Type Frontend `xml:"type,attr"`
+}
+
+type xmlTrustedPlatformModule struct {
+	Type     string `xml:"type,attr"`
+	Location string `xml:"location,attr"`
+}
+
+type xmlGroup struct {
+	Name string `xml:"name,attr"`
+}
+
+type xmlHardware struct {
+	UUID            string                   `xml:"uuid,attr"`
+	BIOSTimeOffset  xmlTimeOffset            `xml:"BIOS>TimeOffset"`
+	BIOSLogo        xmlLogo                  `xml:"BIOS>Logo"`
+	BIOSBootMenu    xmlBootMenu              `xml:"BIOS>BootMenu"`
+	BootOrder       []xmlBootOrder           `xml:"Boot>Order"`
+	SharedFolders   []xmlSharedFolder        `xml:"SharedFolders>SharedFolder"`
+	GuestProperties []xmlGuestProperty       `xml:"GuestProperties>GuestProperty"`
+	Display         xmlDisplay               `xml:"Display"`
+	USBControllers  []xmlUSBController       `xml:"USB>Controllers>Controller"`
+	RemoteDisplay   xmlRemoteDisplay         `xml:"RemoteDisplay"`
+	NetworkAdapters []xmlNetworkAdapter      `xml:"Network>Adapter"`
+	AudioAdapter    xmlAudioAdapter          `xml:"AudioAdapter"`
+	CPU             xmlCPU                   `xml:"CPU"`
+	Memory          xmlMemory                `xml:"Memory"`
+	Firmware        xmlFirmware              `xml:"Firmware"`
+	TPM             xmlTrustedPlatformModule `xml:"TrustedPlatformModule"`
+	Frontend        xmlFrontend              `xml:"Frontend>Default"`
+	Recording       xmlRecording             `xml:"Recording"`
+	NVRAM           xmlNVRAM                 `xml:"NVRAM"`
+	BIOSNVRAM       xmlNVRAM                 `xml:"BIOS>NVRAM"`
+	Platform        xmlPlatform              `xml:"Platform"`
+	xmlPlatformSettings
+}
+
 type xmlMachine struct {
-	Name                string                 `xml:"name,attr"`
-	OSType              string                 `xml:"OSType,attr"`
-	RegisteredHardDisks []xmlHardDisk          `xml:"MediaRegistry>HardDisks>HardDisk"`
-	RemoteDisplay       xmlRemoteDisplay       `xml:"Hardware>RemoteDisplay"`
-	Forwarding          []xmlNetworkForwarding `xml:"Hardware>Network>Adapter>NAT>Forwarding"`
-	AttachedHardDisks   []xmlAttachedDisk      `xml:"StorageControllers>StorageController>AttachedDevice>Image"`
+	Name               string                 `xml:"name,attr"`
+	SnapshotFolder     string                 `xml:"snapshotFolder,attr"`
+	OSType             string                 `xml:"OSType,attr"`
+	LastStateChange    string                 `xml:"lastStateChange,attr"`
+	CurrentSnapshot    string                 `xml:"currentSnapshot,attr"`
+	StateFile          string                 `xml:"stateFile,attr"`
+	Aborted            bool                   `xml:"aborted,attr"`
+	Snapshot           *xmlSnapshot           `xml:"Snapshot"`
+	MediaRegistry      xmlMediaRegistry       `xml:"MediaRegistry"`
+	Groups             []xmlGroup             `xml:"Groups>Group"`
+	ExtraData          []xmlExtraDataItem     `xml:"ExtraData>ExtraDataItem"`
+	Hardware           xmlHardware            `xml:"Hardware"`
+	StorageControllers []xmlStorageController `xml:"StorageControllers>StorageController"`
 }
 
 type xmlMachineRoot struct {
 	XMLName  xml.Name     `xml:"VirtualBox"`
+	Version  string       `xml:"version,attr"`
 	Machines []xmlMachine `xml:"Machine"`
 }
 
@@ -122,11 +307,42 @@ func SetHome(home string) error {
 	return os.Setenv("VBOX_USER_HOME", home)
 }
 
-// Load the given configuration file
-func Decode(configPath string) (vbox *VirtualBox, err error) {
-	runningMachineUUIDs, err := runningMachineUUIDs()
-	if err != nil {
-		return
+// When set, Decode only reads the XML configuration and never runs
+// VBoxManage, marking the Status of every machine Unknown.
+var Offline bool
+
+// The number of machine settings files Decode reads and parses at once.
+var DecodeConcurrency = 8
+
+// Load the given configuration file, using StatusSource through the status
+// cache to find running machines. The default StatusSource falls back to
+// the process table when VBoxManage is missing, so the states are still
+// known then. In Offline mode, or if StatusSource fails because the
+// commands it needs are not installed, the inventory is still decoded with
+// every Status Unknown. Options skip machines that are not of interest
+// without decoding their settings.
+func Decode(configPath string, options ...DecodeOption) (vbox *VirtualBox, err error) {
+	ctx, endSpan := startSpan(context.Background(), "Decode",
+		map[string]string{TracePath: configPath})
+	defer func() { endSpan(err) }()
+
+	filter := new(decodeOptions)
+	for _, option := range options {
+		option(filter)
+	}
+
+	var running map[uuid.UUID]bool
+	if !Offline {
+		running, err = runningMachines(ctx)
+		if errors.Is(err, exec.ErrNotFound) {
+			running, err = nil, nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	if filter.onlyRunning && running == nil {
+		return nil, ErrStatusUnknown
 	}
 
 	// top level xml file
@@ -143,85 +359,265 @@ func Decode(configPath string) (vbox *VirtualBox, err error) {
 	// per machine xml file
 	vbox = new(VirtualBox)
 	vbox.Machines = make(MachineMap, len(machineList.Machines))
-	vbox.HardDisks = make(HardDiskMap)
-
-	for _, machineListEntry := range machineList.Machines {
-		file, err := os.Open(machineListEntry.Source)
-		if err != nil {
-			return nil, err
+	vbox.SystemProperties = machineList.SystemProperties.properties()
+	media, err := machineList.MediaRegistry.media(filepath.Dir(configPath))
+	if err != nil {
+		return nil, err
+	}
+	vbox.mergeMedia(media)
+
+	// decoded concurrently, but merged in the order of the list so the first
+	// of conflicting disks stays the same
+	type decoded struct {
+		machine *Machine
+		media   *registeredMedia
+		err     error
+	}
+	results := make([]decoded, len(machineList.Machines))
+	workers := DecodeConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				entry := machineList.Machines[index]
+				_, endMachineSpan := startSpan(ctx, "DecodeMachine", map[string]string{
+					TraceUUID: entry.UUID,
+					TracePath: entry.Source,
+				})
+				result := &results[index]
+				result.machine, result.media, result.err = decodeMachine(entry, running, filter)
+				endMachineSpan(result.err)
+			}
+		}()
+	}
+	for index, machineListEntry := range machineList.Machines {
+		if filter.matchUUID(machineListEntry.UUID, running) {
+			indexes <- index
 		}
-
-		xmlMachineRoot := new(xmlMachineRoot)
-		err = xml.NewDecoder(file).Decode(xmlMachineRoot)
-		if err != nil {
-			return nil, err
+	}
+	close(indexes)
+	wg.Wait()
+
+	var errs []error
+	for index, result := range results {
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("virtualbox: decoding %s: %w",
+				machineList.Machines[index].Source, result.err))
+			continue
 		}
-
-		if len(xmlMachineRoot.Machines) != 1 {
-			return nil, errors.New("Was expecting exactly 1 machine.")
+		if result.machine != nil {
+			vbox.Machines[result.machine.UUID] = result.machine
+			vbox.mergeMedia(result.media)
 		}
-		xmlMachine := xmlMachineRoot.Machines[0]
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return
+}
+
+// Decode a per machine settings file, returning the machine and the media
+// registered in it. Machines outside the namespace, or not matching the
+// filter, are skipped and result in a nil Machine.
+// A nil runningMachineUUIDs means the state of machines is unknown.
+func decodeMachine(machineListEntry xmlMachineListEntry, runningMachineUUIDs map[uuid.UUID]bool, filter *decodeOptions) (*Machine, *registeredMedia, error) {
+	data, err := os.ReadFile(machineListEntry.Source)
+	if err != nil {
+		return nil, nil, err
+	}
+	match, err := filter.matchSettings(data)
+	if err != nil || !match {
+		return nil, nil, err
+	}
+	fingerprint, err := fingerprintSettings(machineListEntry.Source, data)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		machineUUID, err := uuid.ParseHex(machineListEntry.UUID)
+	xmlMachineRoot := new(xmlMachineRoot)
+	err = xml.Unmarshal(data, xmlMachineRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if Strict {
+		err = xmlMachineRoot.validate(machineListEntry.Source)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+	}
+
+	if len(xmlMachineRoot.Machines) != 1 {
+		return nil, nil, errors.New("Was expecting exactly 1 machine.")
+	}
+	xmlMachine := xmlMachineRoot.Machines[0]
+
+	groups := make([]string, 0, len(xmlMachine.Groups))
+	for _, group := range xmlMachine.Groups {
+		groups = append(groups, group.Name)
+	}
+	if !inNamespace(xmlMachine.Name, groups) {
+		return nil, nil, nil
+	}
+
+	machineUUID, err := uuid.ParseHex(machineListEntry.UUID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		status := Off
-		if runningMachineUUIDs[*machineUUID] {
+	status := Unknown
+	if runningMachineUUIDs != nil {
+		switch {
+		case runningMachineUUIDs[*machineUUID]:
 			status = Running
+		case xmlMachine.Aborted:
+			status = Aborted
+		case xmlMachine.StateFile != "":
+			status = Saved
+		default:
+			status = Off
 		}
+	}
 
-		vrdePort := 0
-		if xmlMachine.RemoteDisplay.Enabled {
-			vrdePortString := findProperty(&xmlMachine.RemoteDisplay.Properties,
-				"TCP/Ports")
-			if vrdePortString != "" {
-				vrdePort, err = strconv.Atoi(vrdePortString)
-				if err != nil {
-					return nil, err
-				}
+	vrdePort := Port(0)
+	if xmlMachine.Hardware.RemoteDisplay.Enabled {
+		vrdePortString := findProperty(&xmlMachine.Hardware.RemoteDisplay.Properties,
+			"TCP/Ports")
+		if vrdePortString != "" {
+			vrdePort, err = parseVRDEPorts(vrdePortString)
+			if err != nil {
+				return nil, nil, err
 			}
 		}
+	}
 
-		seleniumPort := 0
-		for _, forwarding := range xmlMachine.Forwarding {
-			if forwarding.Name == "selenium" {
-				seleniumPort = forwarding.HostPort
+	seleniumPort := Port(0)
+	forwards := make([]PortForward, 0)
+	adapters := make([]*NetworkAdapter, 0, len(xmlMachine.Hardware.NetworkAdapters))
+	for _, xmlAdapter := range xmlMachine.Hardware.NetworkAdapters {
+		adapter := xmlAdapter.adapter()
+		for _, forward := range adapter.Forwards {
+			if forward.Name == "selenium" {
+				seleniumPort = forward.HostPort
 			}
 		}
+		forwards = append(forwards, adapter.Forwards...)
+		adapters = append(adapters, adapter)
+	}
 
-		machine := &Machine{
-			UUID:         *machineUUID,
-			Source:       machineListEntry.Source,
-			Name:         xmlMachine.Name,
-			OSType:       OSType(xmlMachine.OSType),
-			Status:       status,
-			VRDEPort:     vrdePort,
-			SeleniumPort: seleniumPort,
+	machine := &Machine{
+		UUID:         *machineUUID,
+		Source:       machineListEntry.Source,
+		Name:         xmlMachine.Name,
+		OSType:       OSType(xmlMachine.OSType),
+		Status:       status,
+		VRDEEnabled:  xmlMachine.Hardware.RemoteDisplay.Enabled,
+		VRDEPort:     vrdePort,
+		VRDE:         xmlMachine.Hardware.RemoteDisplay.vrde(),
+		SeleniumPort: seleniumPort,
+		CPUs:         xmlMachine.Hardware.CPU.Count,
+		CPUHotPlug:   xmlMachine.Hardware.CPU.HotPlug,
+		CPUCap:       xmlMachine.Hardware.CPU.ExecutionCap,
+		Memory:       xmlMachine.Hardware.Memory.RAMSize,
+		Firmware:     parseFirmware(xmlMachine.Hardware.Firmware.Type),
+		TPM:          parseTPMType(xmlMachine.Hardware.TPM.Type),
+		Frontend:     xmlMachine.Hardware.Frontend.Type,
+		Forwards:     forwards,
+		Groups:       groups,
+
+		NetworkAdapters: adapters,
+
+		SettingsVersion: xmlMachineRoot.Version,
+		LastStateChange: parseStateChangeTime(xmlMachine.LastStateChange),
+		Architecture:    xmlMachine.Hardware.Platform.Architecture,
+		TPMLocation:     xmlMachine.Hardware.TPM.Location,
+		Recording:       xmlMachine.Hardware.Recording.recording(),
+		Audio:           xmlMachine.Hardware.AudioAdapter.output(),
+
+		snapshotFolder: xmlMachine.SnapshotFolder,
+		fingerprint:    fingerprint,
+	}
+	if xmlMachine.Hardware.UUID != "" {
+		machine.HardwareUUID, err = uuid.ParseHex(xmlMachine.Hardware.UUID)
+		if err != nil {
+			return nil, nil, err
 		}
-
-		for _, xmlHardDisk := range xmlMachine.RegisteredHardDisks {
-			_, err := vbox.HardDisks.AddHardDisks(
-				&xmlHardDisk, nil, path.Dir(machine.Source))
-			if err != nil {
-				return nil, err
-			}
+	}
+	timeOffset := xmlMachine.Hardware.BIOSTimeOffset.Value
+	if timeOffset == 0 {
+		timeOffset = xmlMachine.Hardware.Firmware.TimeOffset.Value
+	}
+	machine.BIOSTimeOffset = time.Duration(timeOffset) * time.Millisecond
+	xmlMachine.Hardware.xmlPlatformSettings.apply(machine, &xmlMachine.Hardware.Platform,
+		&xmlMachine.Hardware.Firmware)
+	xmlMachine.Hardware.applyBoot(machine)
+	xmlMachine.Hardware.applyModifiable(machine)
+	machine.NVRAM = xmlMachine.Hardware.NVRAM.Path
+	if machine.NVRAM == "" {
+		machine.NVRAM = xmlMachine.Hardware.BIOSNVRAM.Path
+	}
+	if machine.NVRAM != "" && !filepath.IsAbs(machine.NVRAM) {
+		machine.NVRAM = filepath.Join(filepath.Dir(machine.Source), machine.NVRAM)
+	}
+	if machine.CPUs == 0 {
+		machine.CPUs = 1
+	}
+	if machine.CPUCap == 0 {
+		machine.CPUCap = 100
+	}
+	for _, folder := range xmlMachine.Hardware.SharedFolders {
+		machine.SharedFolders = append(machine.SharedFolders, SharedFolder{
+			Name:       folder.Name,
+			HostPath:   folder.HostPath,
+			Writable:   folder.Writable,
+			AutoMount:  folder.AutoMount,
+			MountPoint: folder.AutoMountPoint,
+		})
+	}
+	for _, item := range xmlMachine.ExtraData {
+		if item.Name == tagsExtraData {
+			machine.Tags = parseTags(item.Value)
 		}
+	}
+	machine.guestIPs = guestIPs(xmlMachine.Hardware.GuestProperties)
+	for _, cpu := range xmlMachine.Hardware.CPU.Tree {
+		machine.PluggedCPUs = append(machine.PluggedCPUs, cpu.ID)
+	}
 
-		machine.HardDisks = make([]*uuid.UUID, len(xmlMachine.AttachedHardDisks))
-		for index, attachedImage := range xmlMachine.AttachedHardDisks {
-			imageUUID, err := uuid.ParseHex(attachedImage.UUID)
-			if err != nil {
-				return nil, err
-			}
-			machine.HardDisks[index] = imageUUID
+	media, err := xmlMachine.MediaRegistry.media(filepath.Dir(machine.Source))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, xmlController := range xmlMachine.StorageControllers {
+		controller, err := xmlController.controller()
+		if err != nil {
+			return nil, nil, err
 		}
+		machine.StorageControllers = append(machine.StorageControllers, controller)
+	}
 
-		vbox.Machines[*machineUUID] = machine
+	if xmlMachine.Snapshot != nil {
+		machine.Snapshots, err = xmlMachine.Snapshot.snapshots(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if xmlMachine.CurrentSnapshot != "" {
+		machine.CurrentSnapshot, err = uuid.ParseHex(xmlMachine.CurrentSnapshot)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return
+	machine.refreshHardDisks()
+
+	return machine, media, nil
 }
 
 func (hardDisks HardDiskMap) AddHardDisks(xmlHardDisk *xmlHardDisk, parent *uuid.UUID, dir string) (disk *HardDisk, err error) {
@@ -238,8 +634,8 @@ func (hardDisks HardDiskMap) AddHardDisks(xmlHardDisk *xmlHardDisk, parent *uuid
 		Parent:    parent,
 	}
 
-	if !path.IsAbs(disk.Location) {
-		disk.Location = path.Join(dir, disk.Location)
+	if !filepath.IsAbs(disk.Location) {
+		disk.Location = filepath.Join(dir, disk.Location)
 	}
 
 	lenChildDisks := len(xmlHardDisk.Children)
@@ -284,9 +680,53 @@ func (machines MachineMap) MarshalJSON() ([]byte, error) {
 	return json.Marshal(machinesStrings)
 }
 
+// Load the disks from the JSON written by MarshalJSON.
+func (disks *HardDiskMap) UnmarshalJSON(data []byte) error {
+	var disksStrings map[string]*HardDisk
+	err := json.Unmarshal(data, &disksStrings)
+	if err != nil {
+		return err
+	}
+	*disks = make(HardDiskMap, len(disksStrings))
+	for uuidString, disk := range disksStrings {
+		diskUUID, err := uuid.ParseHex(uuidString)
+		if err != nil {
+			return fmt.Errorf("virtualbox: invalid disk UUID %q", uuidString)
+		}
+		(*disks)[*diskUUID] = disk
+	}
+	return nil
+}
+
+// Load the machines from the JSON written by MarshalJSON. The settings
+// files are not fingerprinted, so changes made to them in the meantime are
+// not detected by CheckUnmodified.
+func (machines *MachineMap) UnmarshalJSON(data []byte) error {
+	var machinesStrings map[string]*Machine
+	err := json.Unmarshal(data, &machinesStrings)
+	if err != nil {
+		return err
+	}
+	*machines = make(MachineMap, len(machinesStrings))
+	for uuidString, machine := range machinesStrings {
+		machineUUID, err := uuid.ParseHex(uuidString)
+		if err != nil {
+			return fmt.Errorf("virtualbox: invalid machine UUID %q", uuidString)
+		}
+		(*machines)[*machineUUID] = machine
+	}
+	return nil
+}
+
 func (machine *Machine) PowerOff() error {
-	err := exec.Command(
-		"VBoxManage", "controlvm", machine.UUID.String(), "poweroff").Run()
+	return machine.PowerOffContext(context.Background())
+}
+
+// Power off the machine, killing VBoxManage if the context is done first.
+func (machine *Machine) PowerOffContext(ctx context.Context) (err error) {
+	started := time.Now()
+	defer func() { machine.emit(OperationPowerOff, started, err) }()
+	err = machine.controlVMContext(ctx, "poweroff")
 	if err != nil {
 		return err
 	}
@@ -295,12 +735,34 @@ func (machine *Machine) PowerOff() error {
 }
 
 func (machine *Machine) Start(headless bool) error {
-	startType := "gui"
+	return machine.StartContext(context.Background(), headless)
+}
+
+// Start the machine, killing VBoxManage if the context is done first.
+func (machine *Machine) StartContext(ctx context.Context, headless bool) error {
+	startType := GUI
 	if headless {
-		startType = "headless"
+		startType = Headless
 	}
-	err := exec.Command(
-		"VBoxManage", "startvm", machine.UUID.String(), "--type", startType).Run()
+	return machine.StartFrontendContext(ctx, startType)
+}
+
+// Start the machine with the given frontend, where DefaultFrontend uses the
+// machine's default.
+func (machine *Machine) StartFrontend(frontend Frontend) error {
+	return machine.StartFrontendContext(context.Background(), frontend)
+}
+
+// Start the machine with the given frontend, killing VBoxManage if the
+// context is done first.
+func (machine *Machine) StartFrontendContext(ctx context.Context, frontend Frontend) (err error) {
+	started := time.Now()
+	defer func() { machine.emit(OperationStart, started, err) }()
+	args := []string{"startvm", machine.UUID.String()}
+	if frontend != DefaultFrontend && frontend != "" {
+		args = append(args, "--type", string(frontend))
+	}
+	_, err = machine.manage(ctx, args...)
 	if err != nil {
 		return err
 	}
@@ -308,13 +770,10 @@ func (machine *Machine) Start(headless bool) error {
 	return nil
 }
 
-func extractUUIDs(text string) (uuids []*uuid.UUID) {
-	re, err := regexp.Compile("([[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12})")
-	if err != nil {
-		log.Fatal("Failed to compile UUID regexp.")
-	}
+var uuidPattern = regexp.MustCompile("([[:xdigit:]]{8}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{4}-[[:xdigit:]]{12})")
 
-	uuidStrings := re.FindAllString(text, -1)
+func extractUUIDs(text string) (uuids []*uuid.UUID) {
+	uuidStrings := uuidPattern.FindAllString(text, -1)
 	uuids = make([]*uuid.UUID, len(uuidStrings))
 	for index, uuidString := range uuidStrings {
 		uuid, err := uuid.ParseHex(uuidString)
@@ -327,8 +786,8 @@ func extractUUIDs(text string) (uuids []*uuid.UUID) {
 }
 
 // Get a map of UUIDs for running machines
-func runningMachineUUIDs() (uuids map[uuid.UUID]bool, err error) {
-	bytes, err := exec.Command("VBoxManage", "list", "runningvms").Output()
+func runningMachineUUIDs(ctx context.Context) (uuids map[uuid.UUID]bool, err error) {
+	bytes, err := vboxManageContext(ctx, "list", "runningvms")
 	if err != nil {
 		return nil, err
 	}
@@ -346,37 +805,142 @@ type CreateMachine struct {
 	OSType     OSType
 	Register   bool
 	BaseFolder string
+	Groups     []string   // such as "/lab/web"
+	UUID       *uuid.UUID // generated by VirtualBox if nil
+	Default    bool       // apply the default hardware profile for OSType
+	Platform   string     // platform architecture such as "x86" or "arm", VirtualBox 7.1
 }
 
-func (createMachine CreateMachine) Create() (*uuid.UUID, error) {
-	register := ""
-	if createMachine.Register {
-		register = "--register"
+var createdSettingsFile = regexp.MustCompile(`(?m)^Settings file: '(.*)'\s*$`)
+
+// Create the machine and return it decoded from the new settings file. Use
+// VirtualBox.Create to also add it to a decoded VirtualBox.
+func (createMachine CreateMachine) Create() (*Machine, error) {
+	return createMachine.CreateContext(context.Background())
+}
+
+// Create the machine, killing VBoxManage if the context is done first.
+func (createMachine CreateMachine) CreateContext(ctx context.Context) (*Machine, error) {
+	machine, _, err := createMachine.create(ctx)
+	return machine, err
+}
+
+func (createMachine CreateMachine) create(ctx context.Context) (*Machine, *registeredMedia, error) {
+	err := ValidateMachineName(createMachine.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !inNamespace(createMachine.Name, createMachine.Groups) {
+		return nil, nil, ErrOutsideNamespace
 	}
 
-	bytes, err := exec.Command(
-		"VBoxManage", "createvm",
+	args := []string{
+		"createvm",
 		"--name", createMachine.Name,
 		"--ostype", string(createMachine.OSType),
-		register,
-		"--basefolder", createMachine.BaseFolder).CombinedOutput()
+	}
+	if createMachine.BaseFolder != "" {
+		args = append(args, "--basefolder", createMachine.BaseFolder)
+	}
+	if len(createMachine.Groups) != 0 {
+		args = append(args, "--groups", strings.Join(createMachine.Groups, ","))
+	}
+	if createMachine.UUID != nil {
+		args = append(args, "--uuid", createMachine.UUID.String())
+	}
+	if createMachine.Default {
+		args = append(args, "--default")
+	}
+	if createMachine.Platform != "" {
+		args = append(args, "--platform-architecture", createMachine.Platform)
+	}
+	if createMachine.Register {
+		args = append(args, "--register")
+	}
+
+	bytes, err := vboxManageModifyContext(ctx, args...)
 	if err != nil {
-		return nil, fmt.Errorf("Error in createvm, err: %s", err)
+		return nil, nil, fmt.Errorf("Error in createvm, err: %w", err)
 	}
 	uuids := extractUUIDs(string(bytes))
 	if len(uuids) != 1 {
 		log.Fatal("Was expecting exactly 1 UUID.")
 	}
+	match := createdSettingsFile.FindSubmatch(bytes)
+	if match == nil {
+		return nil, nil, errors.New("virtualbox: createvm did not report the settings file")
+	}
+	return decodeMachineFile(uuids[0], string(match[1]))
+}
+
+// Create the machine and add it, along with its disks, to the maps.
+func (vbox *VirtualBox) Create(createMachine CreateMachine) (*Machine, error) {
+	return vbox.CreateContext(context.Background(), createMachine)
+}
+
+// Create the machine and add it to the maps, killing VBoxManage if the
+// context is done first.
+func (vbox *VirtualBox) CreateContext(ctx context.Context, createMachine CreateMachine) (*Machine, error) {
+	machine, media, err := createMachine.create(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vbox.add(machine, media)
+	return machine, nil
+}
+
+// Add a machine and its media to the maps in one step.
+func (vbox *VirtualBox) add(machine *Machine, media *registeredMedia) {
+	vbox.mutex.Lock()
+	defer vbox.mutex.Unlock()
+	if vbox.Machines == nil {
+		vbox.Machines = make(MachineMap)
+	}
+	if vbox.HardDisks == nil {
+		vbox.HardDisks = make(HardDiskMap)
+	}
+	if vbox.DVDImages == nil {
+		vbox.DVDImages = make(DVDImageMap)
+	}
+	if vbox.FloppyImages == nil {
+		vbox.FloppyImages = make(FloppyImageMap)
+	}
+	vbox.Machines[machine.UUID] = machine
+	for diskUUID, disk := range media.hardDisks {
+		vbox.HardDisks[diskUUID] = disk
+	}
+	for imageUUID, image := range media.dvdImages {
+		vbox.DVDImages[imageUUID] = image
+	}
+	for imageUUID, image := range media.floppyImages {
+		vbox.FloppyImages[imageUUID] = image
+	}
+}
 
-	return uuids[0], nil
+// Decode a single machine settings file, returning the machine and the media
+// registered in it.
+func decodeMachineFile(machineUUID *uuid.UUID, source string) (*Machine, *registeredMedia, error) {
+	entry := xmlMachineListEntry{UUID: machineUUID.String(), Source: source}
+	machine, media, err := decodeMachine(entry, map[uuid.UUID]bool{}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if machine == nil {
+		return nil, nil, ErrOutsideNamespace
+	}
+	return machine, media, nil
 }
 
 func (disk *HardDisk) EnsureAutoReset() error {
+	return disk.EnsureAutoResetContext(context.Background())
+}
+
+// Turn on autoreset for the disk, killing VBoxManage if the context is done
+// first.
+func (disk *HardDisk) EnsureAutoResetContext(ctx context.Context) error {
 	if !disk.AutoReset {
-		err := exec.Command(
-			"VBoxManage", "modifyhd",
-			disk.UUID.String(),
-			"--autoreset", "on").Run()
+		_, err := vboxManageModifyContext(ctx,
+			"modifyhd", disk.UUID.String(), "--autoreset", "on")
 		if err != nil {
 			return err
 		}
@@ -385,6 +949,12 @@ func (disk *HardDisk) EnsureAutoReset() error {
 	return nil
 }
 
+// Get the host address to connect to for the selenium forwarding rule.
 func (machine *Machine) SeleniumAddress() string {
-	return "0.0.0.0:" + strconv.Itoa(machine.SeleniumPort)
+	for _, forward := range machine.Forwards {
+		if forward.Name == "selenium" {
+			return forward.HostAddress()
+		}
+	}
+	return net.JoinHostPort(loopbackAddress, machine.SeleniumPort.String())
 }
@@ -0,0 +1,134 @@
+package virtualbox
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+func TestDecodeVirtualBox7(t *testing.T) {
+	tests := []struct {
+		file         string
+		uuid         string
+		architecture string
+		chipset      Chipset
+		ioapic       bool
+		hpet         bool
+		rtcUseUTC    bool
+		tpm          TPMType
+		nvram        string
+		recording    *Recording
+	}{
+		{
+			file:      "vbox70.vbox",
+			uuid:      "6f9c2a3e-1b4d-4c8e-9a7f-3d2e1c0b9a81",
+			chipset:   PIIX3,
+			ioapic:    true,
+			rtcUseUTC: true,
+			tpm:       TPMv2_0,
+			nvram:     "vbox70.nvram",
+		},
+		{
+			file:      "vbox70-recording.vbox",
+			uuid:      "0d1e2f3a-4b5c-4d6e-8f70-8192a3b4c5d6",
+			chipset:   PIIX3,
+			ioapic:    true,
+			rtcUseUTC: true,
+			tpm:       TPMNone,
+			nvram:     "vbox70-recording.nvram",
+			recording: &Recording{
+				Enabled: true,
+				Screens: []RecordingScreen{
+					{
+						ID:          0,
+						Enabled:     true,
+						File:        "/home/user/VirtualBox VMs/vbox70-recording/vbox70-recording-screen0.webm",
+						Options:     "vc_enabled=true,ac_enabled=false",
+						MaxTime:     600,
+						MaxSize:     100,
+						VideoWidth:  1024,
+						VideoHeight: 768,
+						VideoRate:   512,
+						VideoFPS:    25,
+					},
+					{ID: 1},
+				},
+			},
+		},
+		{
+			file:         "vbox71.vbox",
+			uuid:         "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d",
+			architecture: "x86",
+			chipset:      ICH9,
+			ioapic:       true,
+			hpet:         true,
+			rtcUseUTC:    true,
+			tpm:          TPMv2_0,
+			nvram:        "vbox71.nvram",
+		},
+		{
+			file:         "vbox71-recording.vbox",
+			uuid:         "b2c3d4e5-f6a7-4b8c-9d0e-1f2a3b4c5d6e",
+			architecture: "ARM",
+			chipset:      Chipset("armv8virtual"),
+			ioapic:       true,
+			rtcUseUTC:    true,
+			tpm:          TPMNone,
+			nvram:        "vbox71-recording.nvram",
+			recording: &Recording{
+				Enabled: true,
+				Screens: []RecordingScreen{
+					{
+						ID:          0,
+						Enabled:     true,
+						File:        "/home/user/VirtualBox VMs/vbox71-recording/vbox71-recording-screen0.webm",
+						Options:     "vc_enabled=true,ac_enabled=true,ac_profile=med",
+						VideoWidth:  1920,
+						VideoHeight: 1080,
+						VideoRate:   1024,
+						VideoFPS:    30,
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			machineUUID, err := uuid.ParseHex(test.uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source := filepath.Join("testdata", test.file)
+			machine, _, err := decodeMachineFile(machineUUID, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if machine.Architecture != test.architecture {
+				t.Errorf("got architecture %q, want %q", machine.Architecture, test.architecture)
+			}
+			if machine.Chipset != test.chipset {
+				t.Errorf("got chipset %q, want %q", machine.Chipset, test.chipset)
+			}
+			if machine.IOAPIC != test.ioapic {
+				t.Errorf("got IOAPIC %v, want %v", machine.IOAPIC, test.ioapic)
+			}
+			if machine.HPET != test.hpet {
+				t.Errorf("got HPET %v, want %v", machine.HPET, test.hpet)
+			}
+			if machine.RTCUseUTC != test.rtcUseUTC {
+				t.Errorf("got RTCUseUTC %v, want %v", machine.RTCUseUTC, test.rtcUseUTC)
+			}
+			if machine.TPM != test.tpm {
+				t.Errorf("got TPM %q, want %q", machine.TPM, test.tpm)
+			}
+			if nvram := filepath.Join("testdata", test.nvram); machine.NVRAM != nvram {
+				t.Errorf("got NVRAM %q, want %q", machine.NVRAM, nvram)
+			}
+			if !reflect.DeepEqual(machine.Recording, test.recording) {
+				t.Errorf("got recording %+v, want %+v", machine.Recording, test.recording)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package virtualbox
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+type VRDEAuthType string
+
+const (
+	VRDEAuthNull     = VRDEAuthType("null")
+	VRDEAuthExternal = VRDEAuthType("external")
+	VRDEAuthGuest    = VRDEAuthType("guest")
+)
+
+// VRDE properties holding the security settings.
+const (
+	VRDESecurityMethod    = "Security/Method" // RDP, TLS or Negotiate
+	VRDEServerCertificate = "Security/ServerCertificate"
+	VRDEServerPrivateKey  = "Security/ServerPrivateKey"
+	VRDECACertificate     = "Security/CACertificate"
+)
+
+// Used by VirtualBox when the settings do not specify a timeout.
+const defaultVRDEAuthTimeout = 5 * time.Second
+
+// Authentication and security settings of the VRDE server.
+type VRDE struct {
+	AuthType        VRDEAuthType
+	AuthLibrary     string            `json:",omitempty"` // overrides the global library
+	AuthTimeout     time.Duration     `json:",omitempty"`
+	MultiConnection bool              `json:",omitempty"`
+	Properties      map[string]string `json:",omitempty"`
+}
+
+func (remoteDisplay *xmlRemoteDisplay) vrde() *VRDE {
+	vrde := &VRDE{
+		AuthType:        VRDEAuthNull,
+		AuthLibrary:     remoteDisplay.AuthLibrary,
+		AuthTimeout:     defaultVRDEAuthTimeout,
+		MultiConnection: remoteDisplay.MultiConnection,
+	}
+	if remoteDisplay.AuthType != "" {
+		vrde.AuthType = VRDEAuthType(strings.ToLower(remoteDisplay.AuthType))
+	}
+	if remoteDisplay.AuthTimeout != 0 {
+		vrde.AuthTimeout = time.Duration(remoteDisplay.AuthTimeout) * time.Millisecond
+	}
+	if len(remoteDisplay.Properties) != 0 {
+		vrde.Properties = make(map[string]string, len(remoteDisplay.Properties))
+		for _, property := range remoteDisplay.Properties {
+			vrde.Properties[property.Name] = property.Value
+		}
+	}
+	return vrde
+}
+
+// Check if clients have to authenticate.
+func (vrde *VRDE) RequiresAuthentication() bool {
+	return vrde.AuthType != VRDEAuthNull
+}
+
+// Get the security method, which defaults to negotiating TLS with clients
+// that support it.
+func (vrde *VRDE) SecurityMethod() string {
+	if method := vrde.Properties[VRDESecurityMethod]; method != "" {
+		return method
+	}
+	return "Negotiate"
+}
+
+// Check if connections are always encrypted with TLS, which needs a server
+// certificate to be configured.
+func (vrde *VRDE) RequiresTLS() bool {
+	return strings.EqualFold(vrde.SecurityMethod(), "TLS") &&
+		vrde.Properties[VRDEServerCertificate] != ""
+}
+
+// VRDE properties holding the listening address and ports.
+const (
+	VRDEAddressProperty = "TCP/Address"
+	VRDEPortsProperty   = "TCP/Ports"
+)
+
+// Parse a VRDE port list such as "3389" or "5000-5050,5060", returning the
+// first port. The server listens on the first one free when it starts.
+func parseVRDEPorts(ports string) (Port, error) {
+	var first Port
+	for _, part := range strings.Split(ports, ",") {
+		low, high, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		lowPort, err := ParsePort(low)
+		if err != nil {
+			return 0, err
+		}
+		if isRange {
+			highPort, err := ParsePort(high)
+			if err != nil {
+				return 0, err
+			}
+			if highPort < lowPort {
+				return 0, fmt.Errorf("virtualbox: invalid VRDE port range %q", part)
+			}
+		}
+		if first == 0 {
+			first = lowPort
+		}
+	}
+	return first, nil
+}
+
+// Enable the VRDE server listening on the first free port of the range,
+// such as "3389" or "5000-5050,5060", with the authentication type. The
+// authentication type of a running machine can not be changed, so it has
+// to match the current one.
+func (machine *Machine) EnableVRDE(portRange string, auth VRDEAuthType) error {
+	port, err := parseVRDEPorts(portRange)
+	if err != nil {
+		return err
+	}
+	if machine.Status == Running {
+		if machine.VRDE != nil && machine.VRDE.AuthType != auth {
+			return fmt.Errorf("virtualbox: the VRDE authentication of running machine %s is %s",
+				machine.Name, machine.VRDE.AuthType)
+		}
+		err = machine.controlVM("vrdeport", portRange)
+		if err == nil {
+			err = machine.controlVM("vrde", "on")
+		}
+	} else {
+		err = machine.modifyVM("--vrde", "on", "--vrdeport", portRange,
+			"--vrdeauthtype", string(auth))
+	}
+	if err != nil {
+		return err
+	}
+	machine.VRDEEnabled = true
+	machine.VRDEPort = port
+	if machine.VRDE != nil {
+		machine.VRDE.AuthType = auth
+		if machine.VRDE.Properties == nil {
+			machine.VRDE.Properties = make(map[string]string)
+		}
+		machine.VRDE.Properties[VRDEPortsProperty] = portRange
+	}
+	return nil
+}
+
+// Disable the VRDE server, disconnecting any clients of a running machine.
+func (machine *Machine) DisableVRDE() error {
+	var err error
+	if machine.Status == Running {
+		err = machine.controlVM("vrde", "off")
+	} else {
+		err = machine.modifyVM("--vrde", "off")
+	}
+	if err != nil {
+		return err
+	}
+	machine.VRDEEnabled = false
+	return nil
+}
+
+// Get the host address clients connect to for the VRDE server. For running
+// machines it is the port the server bound, otherwise the configured port,
+// which has to be a single one as the port of a range is chosen on start.
+// Servers listening on all interfaces are reached on the loopback address.
+func (machine *Machine) VRDEAddress() (string, error) {
+	if !machine.VRDEEnabled {
+		return "", fmt.Errorf("virtualbox: VRDE is disabled for machine %s", machine.Name)
+	}
+	var address, ports string
+	if machine.VRDE != nil {
+		address = machine.VRDE.Properties[VRDEAddressProperty]
+		ports = machine.VRDE.Properties[VRDEPortsProperty]
+	}
+	port := machine.VRDEPort
+	if machine.Status == Running {
+		info, err := showVMInfo(machine.UUID.String())
+		if err != nil {
+			return "", err
+		}
+		address = info["vrdeaddress"]
+		port, err = ParsePort(info["vrdeport"])
+		if err != nil {
+			return "", fmt.Errorf("virtualbox: the VRDE server of machine %s is not listening",
+				machine.Name)
+		}
+	} else if strings.ContainsAny(ports, ",-") {
+		return "", fmt.Errorf("virtualbox: the VRDE port of machine %s is chosen from %s on start",
+			machine.Name, ports)
+	}
+	if port == 0 {
+		port = 3389 // the VirtualBox default
+	}
+	return hostAddress(address, port), nil
+}
+
+// The authentication library bundled with VirtualBox that checks users
+// configured through SetVRDEPassword.
+const VBoxAuthSimple = "VBoxAuthSimple"
+
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Set the global VRDE external authentication library.
+func SetVRDEAuthLibrary(library string) error {
+	return SetSystemProperty("vrdeauthlibrary", library)
+}
+
+// Set the VRDE authentication type for the machine.
+func (machine *Machine) SetVRDEAuthType(authType VRDEAuthType) error {
+	err := machine.modifyVM("--vrdeauthtype", string(authType))
+	if err != nil {
+		return err
+	}
+	if machine.VRDE != nil {
+		machine.VRDE.AuthType = authType
+	}
+	return nil
+}
+
+// Set the VRDE external authentication library for the machine, overriding
+// the global setting.
+func (machine *Machine) SetVRDEAuthLibrary(library string) error {
+	err := machine.modifyVM("--vrdeauthlibrary", library)
+	if err != nil {
+		return err
+	}
+	if machine.VRDE != nil {
+		machine.VRDE.AuthLibrary = library
+	}
+	return nil
+}
+
+// Set a VRDE property, using controlvm for running machines so the change
+// takes effect immediately.
+func (machine *Machine) SetVRDEProperty(name, value string) error {
+	var err error
+	if machine.Status == Running {
+		err = machine.controlVM("vrdeproperty", name+"="+value)
+	} else {
+		err = machine.modifyVM("--vrdeproperty", name+"="+value)
+	}
+	if err != nil {
+		return err
+	}
+	if machine.VRDE != nil {
+		if machine.VRDE.Properties == nil {
+			machine.VRDE.Properties = make(map[string]string)
+		}
+		machine.VRDE.Properties[name] = value
+		if value == "" {
+			delete(machine.VRDE.Properties, name)
+		}
+	}
+	return nil
+}
+
+// Hash a password the way VBoxAuthSimple expects.
+func vrdePasswordHash(password string) (string, error) {
+	bytes, err := vboxManage("internalcommands", "passwordhash", password)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if hash := strings.TrimPrefix(line, "Password hash: "); hash != line {
+			return strings.TrimSpace(hash), nil
+		}
+	}
+	return "", errors.New("virtualbox: unexpected passwordhash output")
+}
+
+// Set the password for a VBoxAuthSimple user of the machine.
+func (machine *Machine) SetVRDEPassword(username, password string) error {
+	if ReadOnly {
+		return ErrReadOnly
+	}
+	hash, err := vrdePasswordHash(password)
+	if err != nil {
+		return err
+	}
+	_, err = machine.manage(context.Background(), "setextradata", machine.UUID.String(),
+		"VBoxAuthSimple/users/"+username, hash)
+	return err
+}
+
+// Remove a VBoxAuthSimple user from the machine.
+func (machine *Machine) RemoveVRDEUser(username string) error {
+	_, err := machine.manage(context.Background(), "setextradata", machine.UUID.String(),
+		"VBoxAuthSimple/users/"+username)
+	return err
+}
+
+// Generate a random password of the given length from an alphabet without
+// easily confused characters.
+func GeneratePassword(length int) (string, error) {
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	password := make([]byte, length)
+	for index := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[index] = passwordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// Generate a fresh password for a VBoxAuthSimple user of the machine,
+// replacing any previous one, and return it. Callers wanting single use
+// access should call RemoveVRDEUser once the session has been established.
+func (machine *Machine) OneTimeVRDEPassword(username string) (string, error) {
+	password, err := GeneratePassword(16)
+	if err != nil {
+		return "", err
+	}
+	err = machine.SetVRDEPassword(username, password)
+	if err != nil {
+		return "", err
+	}
+	return password, nil
+}
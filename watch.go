@@ -0,0 +1,194 @@
+package virtualbox
+
+import (
+	"context"
+	"os"
+	"time"
+
+	uuid "github.com/daaku/gouuid"
+)
+
+// A machine changed state. Machines registered while watching have an
+// empty From, and machines unregistered an empty To.
+type MachineStateChanged struct {
+	Machine uuid.UUID
+	Name    string
+	From    Status
+	To      Status
+	Time    time.Time // of the change as reported by VirtualBox, or when it was seen
+}
+
+// Polls VirtualBox for machines changing state. Every poll lists the
+// machines and the running ones; only machines that are running, or were
+// or are in a transition, or whose settings file changed, are queried with
+// showvminfo, so watching a host with many machines that are off stays
+// cheap.
+type Watcher struct {
+	Interval time.Duration // PollInterval if zero
+
+	OnError func(err error) // optional
+}
+
+type watchedMachine struct {
+	name        string
+	status      Status
+	inNamespace bool
+	source      string
+	modTime     time.Time // of the settings file when queried
+}
+
+func (watcher *Watcher) reportError(err error) {
+	if err != nil && watcher.OnError != nil {
+		watcher.OnError(err)
+	}
+}
+
+// Check if the machine can only leave the state by being started, which
+// shows up in the running machines, or by changing its settings file, as
+// restoring a snapshot or discarding the saved state do.
+func (status Status) settled() bool {
+	switch status {
+	case Off, Saved, Aborted, Teleported:
+		return true
+	}
+	return false
+}
+
+// Get the modification time of the settings file, zero if it cannot be
+// found.
+func (machine *watchedMachine) settingsModTime() time.Time {
+	info, err := os.Stat(machine.source)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Check if the settings file is the one seen when the machine was queried.
+func (machine *watchedMachine) unchanged() bool {
+	modTime := machine.settingsModTime()
+	return !modTime.IsZero() && modTime.Equal(machine.modTime)
+}
+
+// Deliver state changes of the machines in the namespace until the context
+// is done, when the channel is closed. The states found by the first poll
+// are not delivered.
+func (watcher *Watcher) Watch(ctx context.Context) <-chan MachineStateChanged {
+	events := make(chan MachineStateChanged)
+	go func() {
+		defer close(events)
+		interval := watcher.Interval
+		if interval == 0 {
+			interval = PollInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var known map[uuid.UUID]*watchedMachine
+		for {
+			known = watcher.poll(ctx, known, events)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events
+}
+
+// Find the current state of the machines, delivering the changes from the
+// known ones unless this is the first poll.
+func (watcher *Watcher) poll(ctx context.Context, known map[uuid.UUID]*watchedMachine, events chan<- MachineStateChanged) map[uuid.UUID]*watchedMachine {
+	bytes, err := vboxManageContext(ctx, "list", "vms")
+	if err != nil {
+		watcher.reportError(err)
+		return known
+	}
+	machineUUIDs, err := parseListedMachines(string(bytes))
+	if err != nil {
+		watcher.reportError(err)
+		return known
+	}
+	running, err := runningMachines(ctx)
+	if err != nil {
+		watcher.reportError(err)
+		return known
+	}
+
+	send := func(event MachineStateChanged) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	current := make(map[uuid.UUID]*watchedMachine, len(machineUUIDs))
+	for _, machineUUID := range machineUUIDs {
+		previous := known[*machineUUID]
+		if previous != nil && previous.status.settled() && !running[*machineUUID] &&
+			previous.unchanged() {
+			current[*machineUUID] = previous
+			continue
+		}
+		// stat before querying, so changes made meanwhile are seen next time
+		var modTime time.Time
+		if previous != nil {
+			modTime = previous.settingsModTime()
+		}
+		found, _, err := showMachine(ctx, machineUUID.String())
+		if err != nil {
+			// the machine may have been unregistered since listing it
+			watcher.reportError(err)
+			if previous != nil {
+				current[*machineUUID] = previous
+			}
+			continue
+		}
+		machine := &watchedMachine{
+			name:        found.Name,
+			status:      found.Status,
+			inNamespace: found.InNamespace(),
+			source:      found.Source,
+			modTime:     modTime,
+		}
+		if previous == nil || previous.source != found.Source {
+			machine.modTime = machine.settingsModTime()
+		}
+		current[*machineUUID] = machine
+		if known == nil || !machine.inNamespace || (previous != nil && previous.status == machine.status) {
+			continue
+		}
+		event := MachineStateChanged{
+			Machine: *machineUUID,
+			Name:    machine.name,
+			To:      machine.status,
+			Time:    found.LastStateChange,
+		}
+		if previous != nil {
+			event.From = previous.status
+		}
+		if event.Time.IsZero() {
+			event.Time = time.Now()
+		}
+		if !send(event) {
+			return current
+		}
+	}
+
+	for machineUUID, previous := range known {
+		if current[machineUUID] != nil || !previous.inNamespace {
+			continue
+		}
+		event := MachineStateChanged{
+			Machine: machineUUID,
+			Name:    previous.name,
+			From:    previous.status,
+			Time:    time.Now(),
+		}
+		if !send(event) {
+			break
+		}
+	}
+	return current
+}